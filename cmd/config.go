@@ -0,0 +1,59 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"os"
+
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/adakailabs/gocard/config"
+
+	"github.com/spf13/cobra"
+)
+
+// configCmd represents the config command
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the gocard configuration",
+	Long: `Inspect the configuration gocard is running with.
+
+Values are read from the gocard.yaml file, deep merged with the overlay of
+every --profile given (gocard.<profile>.yaml next to it, in order) and may
+be overridden by environment variables prefixed with GOCARD_. Nested keys
+use underscores, e.g. cardano_hasprometheus.port is set with
+GOCARD_CARDANO_HASPROMETHEUS_PORT.`,
+}
+
+// configShowCmd represents the config show command
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the effective configuration and where each value comes from",
+	Long: `Show the effective configuration, the precedence rules and the source of every value.
+References are shown as written and are not resolved.`,
+	Annotations: map[string]string{annotationKeepReferences: ""},
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := config.WriteSettings(os.Stdout); err != nil {
+			logrus.Fatal(errors.ErrorStack(err))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configShowCmd)
+}
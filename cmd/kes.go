@@ -0,0 +1,339 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/adakailabs/gocard/config"
+	"github.com/adakailabs/gocard/node"
+	"github.com/adakailabs/gocard/pool"
+
+	"github.com/spf13/cobra"
+)
+
+const kesExpiryWarning = 7 * 24 * time.Hour
+
+var kesSlot int64
+var kesOpCert string
+var kesPeriod int64
+var kesCounter uint64
+
+// kesCmd represents the pool kes command
+var kesCmd = &cobra.Command{
+	Use:   "kes",
+	Short: "Check and rotate the KES keys of the block producer",
+}
+
+// kesStatusCmd represents the pool kes status command
+var kesStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the KES period and the expiry of the operational certificate",
+	Long: `Compute the current KES period from the node tip, or --slot, and the
+slotsPerKESPeriod of the shelley genesis, and show the validity of the
+operational certificate: --opcert, producer_keys.operational_certificate
+or the one of the key set, valid for maxKESEvolutions periods from its
+start. Exits with 1 when the certificate is expired or not yet valid, a
+block producer cannot forge with it.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		c := config.New()
+		params, err := kesParams(c)
+		if err != nil {
+			logrus.Fatal(errors.ErrorStack(err))
+		}
+		slot, err := currentSlot(cmd, c, false)
+		if err != nil {
+			logrus.Fatal(errors.ErrorStack(err))
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "slot\t%d\n", slot)
+		fmt.Fprintf(w, "KES period\t%d\n", params.Period(slot))
+		fmt.Fprintf(w, "slots per KES period\t%d\n", params.SlotsPerKESPeriod)
+		fmt.Fprintf(w, "max KES evolutions\t%d\n", params.MaxKESEvolutions)
+
+		certFile := kesOpCertFile(c)
+		if certFile == "" {
+			fmt.Fprintf(w, "operational certificate\tnone\n")
+			w.Flush()
+			return
+		}
+		data, err := ioutil.ReadFile(certFile)
+		if err != nil {
+			logrus.Fatal(errors.ErrorStack(errors.Annotatef(err, "reading %s", certFile)))
+		}
+		cert, err := pool.ParseOpCert(data)
+		if err != nil {
+			logrus.Fatal(errors.ErrorStack(errors.Annotate(err, certFile)))
+		}
+		now := time.Now()
+		status, err := pool.Status(params, cert, slot, now)
+		if err != nil {
+			logrus.Fatal(errors.ErrorStack(err))
+		}
+
+		fmt.Fprintf(w, "operational certificate\t%s\n", certFile)
+		fmt.Fprintf(w, "counter\t%d\n", cert.Counter)
+		fmt.Fprintf(w, "valid KES periods\t%d to %d\n", status.StartPeriod, status.EndPeriod-1)
+		fmt.Fprintf(w, "remaining KES periods\t%d\n", status.Remaining)
+		fmt.Fprintf(w, "expiry slot\t%d\n", status.ExpirySlot)
+		fmt.Fprintf(w, "expires\t%s (in %s)\n", status.Expires.UTC().Format(time.RFC3339),
+			status.Expires.Sub(now).Round(time.Minute))
+		if m, err := pool.ReadManifest(poolDir(c)); err == nil && m.Pending != nil {
+			fmt.Fprintf(w, "pending rotation\tcounter %d, KES period %d, since %s\n",
+				m.Pending.Counter, m.Pending.KESPeriod, m.Pending.Created.Format(time.RFC3339))
+		}
+		w.Flush()
+
+		switch {
+		case status.Expired():
+			logrus.Error("the operational certificate is expired, run gocard pool kes rotate")
+			os.Exit(1)
+		case status.NotYetValid():
+			logrus.Errorf("the operational certificate starts at KES period %d, after the current one", status.StartPeriod)
+			os.Exit(1)
+		case status.Expires.Sub(now) < kesExpiryWarning:
+			logrus.Warn("the operational certificate expires soon, run gocard pool kes rotate")
+		}
+	},
+}
+
+// kesRotateCmd represents the pool kes rotate command
+var kesRotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Generate new KES keys and their operational certificate",
+	Long: `Generate new KES keys in the key set (see gocard pool keys generate) for
+the current KES period, or --kes-period.
+
+When the cold signing key and the issue counter are in the key set the
+operational certificate is issued right away, and the keys and certificate
+replace the current ones. Otherwise the keys wait in node/pending with an
+opcert-request.json holding the cardano-cli commands to run where the cold
+keys are; install the certificate with gocard pool kes install.
+
+The new certificate's counter is the one on chain plus one, the counter of
+the pool's last certificate that forged a block as read from the running
+node, or 0 when none did. Without a running node give it with --counter. An
+issue counter past it is refused unless --counter is given: use it to reuse
+the counter of a certificate that never forged a block. Restart the block
+producer to forge with the new keys.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		c := config.New()
+		opts := pool.RotateOptions{KESPeriod: kesPeriod}
+		if !cmd.Flags().Changed("kes-period") {
+			params, err := kesParams(c)
+			if err != nil {
+				logrus.Fatal(errors.ErrorStack(err))
+			}
+			slot, err := currentSlot(cmd, c, true)
+			if err != nil {
+				logrus.Fatal(errors.ErrorStack(err))
+			}
+			opts.KESPeriod = params.Period(slot)
+		}
+		if cmd.Flags().Changed("counter") {
+			opts.Counter = &kesCounter
+		} else {
+			counter, err := chainCounter(c)
+			if err != nil {
+				logrus.Fatal(errors.ErrorStack(err))
+			}
+			opts.ChainCounter = &counter
+		}
+		opts.Era = c.Pool.CliEra
+
+		ctx := context.Background()
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			logrus.Fatal(errors.ErrorStack(err))
+		}
+		runner, err := node.NewContainerCli(ctx, cli, c, poolNodeContainer)
+		if err != nil {
+			logrus.Fatal(errors.ErrorStack(err))
+		}
+		dir := poolDir(c)
+		rot, err := pool.Rotate(ctx, runner, dir, opts)
+		if closeErr := runner.Close(ctx); closeErr != nil {
+			logrus.Error(errors.ErrorStack(closeErr))
+		}
+		if err != nil {
+			logrus.Fatal(errors.ErrorStack(err))
+		}
+
+		if rot.CounterReset {
+			logrus.Warnf("the issue counter was set to %d", rot.Counter)
+		}
+		if rot.Cert != nil {
+			logrus.Infof("operational certificate issued: counter %d, KES period %d", rot.Counter, rot.KESPeriod)
+			logrus.Info("restart the block producer to forge with the new keys")
+			return
+		}
+
+		logrus.Infof("no cold keys in %s, KES keys kept in %s", dir, filepath.Dir(filepath.Join(dir, rot.Request.KESVerificationKey)))
+		logrus.Infof("copy %s next to the cold keys and run:", rot.Request.KESVerificationKey)
+		for _, command := range rot.Request.Commands {
+			fmt.Println(strings.Join(command, " "))
+		}
+		logrus.Info("then install the certificate with: gocard pool kes install node.cert")
+	},
+}
+
+// kesInstallCmd represents the pool kes install command
+var kesInstallCmd = &cobra.Command{
+	Use:   "install node.cert",
+	Short: "Install the operational certificate of the pending KES keys",
+	Long: `Install an operational certificate issued for the request written by
+gocard pool kes rotate. The certificate must certify the pending KES key,
+and be signed by the cold key of the key set when its verification key is
+there. The pending keys and the certificate replace the current ones.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c := config.New()
+		dir := poolDir(c)
+		m, err := pool.ReadManifest(dir)
+		if err != nil {
+			logrus.Fatal(errors.ErrorStack(err))
+		}
+		data, err := ioutil.ReadFile(args[0])
+		if err != nil {
+			logrus.Fatal(errors.ErrorStack(err))
+		}
+		cert, err := pool.InstallOpCert(dir, data)
+		if err != nil {
+			logrus.Fatal(errors.ErrorStack(err))
+		}
+
+		if m.Pending != nil && (cert.Counter != m.Pending.Counter || cert.KESPeriod != m.Pending.KESPeriod) {
+			logrus.Warnf("the certificate has counter %d and KES period %d, %d and %d were requested",
+				cert.Counter, cert.KESPeriod, m.Pending.Counter, m.Pending.KESPeriod)
+		}
+		logrus.Infof("operational certificate installed: counter %d, KES period %d", cert.Counter, cert.KESPeriod)
+		logrus.Info("restart the block producer to forge with the new keys")
+	},
+}
+
+// kesParams reads the KES parameters of the shelley genesis.
+func kesParams(c *config.Config) (pool.KESParams, error) {
+	genesis, err := c.ShelleyGenesis()
+	if err != nil {
+		return pool.KESParams{}, err
+	}
+	params := pool.KESParams{
+		SlotsPerKESPeriod: genesis.SlotsPerKESPeriod,
+		MaxKESEvolutions:  genesis.MaxKESEvolutions,
+		SlotLength:        genesis.SlotLength,
+	}
+	return params, params.Validate()
+}
+
+// currentSlot returns --slot, or the slot of the tip of the running node.
+// A node that is not synced is refused when synced is set, its tip is in
+// the past.
+func currentSlot(cmd *cobra.Command, c *config.Config, synced bool) (int64, error) {
+	if cmd.Flags().Changed("slot") {
+		return kesSlot, nil
+	}
+	if !c.ContainerIsUP {
+		return 0, errors.New("the node container is not running, give the current slot with --slot")
+	}
+
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return 0, err
+	}
+	tip, err := node.QueryTip(context.Background(), cli, c, c.ContainerID)
+	if err != nil {
+		return 0, err
+	}
+	if tip.SyncProgress != "" && tip.SyncProgress != "100.00" {
+		if synced {
+			return 0, errors.Errorf("the node is %s%% synced, its tip is not the current slot: give it with --slot", tip.SyncProgress)
+		}
+		logrus.Warnf("the node is %s%% synced, the KES period is the one of its tip", tip.SyncProgress)
+	}
+	return tip.Slot, nil
+}
+
+// chainCounter returns the counter on chain of the key set's pool, read
+// from the running node.
+func chainCounter(c *config.Config) (uint64, error) {
+	if !c.ContainerIsUP {
+		return 0, errors.New("the node container is not running, give the counter with --counter")
+	}
+	m, err := pool.ReadManifest(poolDir(c))
+	if err != nil {
+		return 0, err
+	}
+	if m.PoolID == "" {
+		return 0, errors.New("the key set has no pool id, give the counter with --counter")
+	}
+
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return 0, err
+	}
+	state, err := node.QueryProtocolState(context.Background(), cli, c, c.ContainerID)
+	if err != nil {
+		return 0, errors.Annotate(err, "reading the counter on chain, give it with --counter")
+	}
+	counter, err := pool.ChainCounter(state, m.PoolID)
+	if err != nil {
+		return 0, errors.Annotate(err, "reading the counter on chain, give it with --counter")
+	}
+	logrus.Infof("the counter on chain is %d", counter)
+	return counter, nil
+}
+
+// kesOpCertFile returns the operational certificate to check: --opcert,
+// the producer's or the key set's.
+func kesOpCertFile(c *config.Config) string {
+	if kesOpCert != "" {
+		return kesOpCert
+	}
+	if c.ProducerKeys.OperationalCertificate != "" {
+		return c.ProducerKeys.OperationalCertificate
+	}
+	dir := poolDir(c)
+	if m, err := pool.ReadManifest(dir); err == nil {
+		if f := m.Find(pool.RoleKES, pool.KindOpCert); f != nil {
+			return filepath.Join(dir, f.Path)
+		}
+	}
+	return ""
+}
+
+func init() {
+	poolCmd.AddCommand(kesCmd)
+	kesCmd.AddCommand(kesStatusCmd)
+	kesCmd.AddCommand(kesRotateCmd)
+	kesCmd.AddCommand(kesInstallCmd)
+
+	kesCmd.PersistentFlags().Int64Var(&kesSlot, "slot", 0, "current slot, when the node is not running or not synced")
+	kesStatusCmd.Flags().StringVar(&kesOpCert, "opcert", "", "operational certificate to check")
+	kesRotateCmd.Flags().Int64Var(&kesPeriod, "kes-period", 0, "start KES period of the new certificate, the current one by default")
+	kesRotateCmd.Flags().Uint64Var(&kesCounter, "counter", 0, "counter of the new certificate")
+}
@@ -0,0 +1,201 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/adakailabs/gocard/config"
+
+	"github.com/spf13/cobra"
+)
+
+var upstreamDir string
+var rollbackBackup string
+
+// nodeConfigCmd represents the node config command
+var nodeConfigCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect, edit, upgrade and roll back the cardano-node configuration files",
+}
+
+// nodeConfigDiffCmd represents the node config diff command
+var nodeConfigDiffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Show what changed upstream versus the local configuration files",
+	Long: fmt.Sprintf(`Fetch the published configuration files (or load them with --from-dir)
+and show a semantic JSON diff against the local ones. The config.json
+settings managed by gocard (%s and the tracers
+of the cardano_tracers preset) are ignored.`, strings.Join(config.ManagedConfigKeys(), ", ")),
+	Run: func(cmd *cobra.Command, args []string) {
+		c := config.New()
+		dir, err := c.FetchUpstream(upstreamDir)
+		if err != nil {
+			logrus.Fatal(errors.ErrorStack(err))
+		}
+		defer os.RemoveAll(dir)
+
+		diffs, err := c.DiffUpstream(dir)
+		if err != nil {
+			logrus.Fatal(errors.ErrorStack(err))
+		}
+		config.WriteDiffs(os.Stdout, diffs)
+	},
+}
+
+// nodeConfigUpgradeCmd represents the node config upgrade command
+var nodeConfigUpgradeCmd = &cobra.Command{
+	Use:   "upgrade",
+	Short: "Replace the local configuration files with the upstream ones",
+	Long: `Back up the local configuration files to a timestamped directory, replace
+them with the upstream ones and re-apply the gocard settings. If the result
+fails verification the backup is restored. Use "gocard node config rollback"
+to go back to the previous files later.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		c := config.New()
+		dir, err := c.FetchUpstream(upstreamDir)
+		if err != nil {
+			logrus.Fatal(errors.ErrorStack(err))
+		}
+		defer os.RemoveAll(dir)
+
+		diffs, err := c.DiffUpstream(dir)
+		if err != nil {
+			logrus.Fatal(errors.ErrorStack(err))
+		}
+		config.WriteDiffs(os.Stdout, diffs)
+
+		backup, err := c.UpgradeConfig(dir)
+		if err != nil {
+			logrus.Fatal(errors.ErrorStack(err))
+		}
+		logrus.Infof("config upgraded, previous files kept in backup %s", backup)
+	},
+}
+
+// nodeConfigRollbackCmd represents the node config rollback command
+var nodeConfigRollbackCmd = &cobra.Command{
+	Use:   "rollback",
+	Short: "Restore the configuration files from a backup, the latest by default",
+	Run: func(cmd *cobra.Command, args []string) {
+		c := config.New()
+		if err := c.RollbackConfig(rollbackBackup); err != nil {
+			logrus.Fatal(errors.ErrorStack(err))
+		}
+	},
+}
+
+// nodeConfigBackupsCmd represents the node config backups command
+var nodeConfigBackupsCmd = &cobra.Command{
+	Use:   "backups",
+	Short: "List the configuration backups",
+	Run: func(cmd *cobra.Command, args []string) {
+		backups, err := config.New().ConfigBackups()
+		if err != nil {
+			logrus.Fatal(errors.ErrorStack(err))
+		}
+		for _, backup := range backups {
+			fmt.Println(backup)
+		}
+	},
+}
+
+// nodeConfigGetCmd represents the node config get command
+var nodeConfigGetCmd = &cobra.Command{
+	Use:   "get [key]",
+	Short: "Print a config.json setting, or the whole file",
+	Long: `Print the value of a config.json setting as JSON. Nested settings are
+addressed with dots, e.g. "options.mapBackends".`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c := config.New()
+		nodeConfig, err := config.LoadNodeConfig(c.NodeConfigFile())
+		if err != nil {
+			logrus.Fatal(errors.ErrorStack(err))
+		}
+		if len(args) == 0 {
+			fmt.Println(nodeConfig)
+			return
+		}
+
+		value, err := nodeConfig.Get(args[0])
+		if err != nil {
+			logrus.Fatal(err.Error())
+		}
+		fmt.Println(string(value))
+	},
+}
+
+// nodeConfigSetCmd represents the node config set command
+var nodeConfigSetCmd = &cobra.Command{
+	Use:   "set key value",
+	Short: "Change a config.json setting",
+	Long: `Change a config.json setting. The value is read as JSON when it parses,
+as a string otherwise, e.g.:
+
+  gocard node config set TraceMempool false
+  gocard node config set hasEKG 12788
+  gocard node config set minSeverity Info
+
+The file is backed up first and the result must still be a valid node
+configuration. Settings managed by gocard are overwritten on the next init
+or reload.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		key, value := args[0], args[1]
+		c := config.New()
+		nodeConfig, err := config.LoadNodeConfig(c.NodeConfigFile())
+		if err != nil {
+			logrus.Fatal(errors.ErrorStack(err))
+		}
+		if c.IsManagedConfigKey(key, nodeConfig) {
+			logrus.Warnf("%s is managed by gocard, the change is lost on the next init or reload", key)
+		}
+		if err = nodeConfig.Set(key, config.ParseValue(value)); err != nil {
+			logrus.Fatal(err.Error())
+		}
+
+		backup, err := c.BackupConfig()
+		if err != nil {
+			logrus.Fatal(errors.ErrorStack(err))
+		}
+		if err = nodeConfig.Save(c.NodeConfigFile()); err != nil {
+			logrus.Fatal(errors.ErrorStack(err))
+		}
+		logrus.Infof("%s set, previous files kept in backup %s; restart the node to apply it", key, backup)
+	},
+}
+
+func init() {
+	nodeCmd.AddCommand(nodeConfigCmd)
+	nodeConfigCmd.AddCommand(nodeConfigDiffCmd)
+	nodeConfigCmd.AddCommand(nodeConfigUpgradeCmd)
+	nodeConfigCmd.AddCommand(nodeConfigRollbackCmd)
+	nodeConfigCmd.AddCommand(nodeConfigBackupsCmd)
+	nodeConfigCmd.AddCommand(nodeConfigGetCmd)
+	nodeConfigCmd.AddCommand(nodeConfigSetCmd)
+
+	nodeConfigDiffCmd.Flags().StringVar(&upstreamDir, "from-dir", "",
+		"load the upstream files from this directory, named as published, instead of fetching them")
+	nodeConfigUpgradeCmd.Flags().StringVar(&upstreamDir, "from-dir", "",
+		"load the upstream files from this directory, named as published, instead of fetching them")
+	nodeConfigRollbackCmd.Flags().StringVar(&rollbackBackup, "backup", "", "backup to restore, see \"node config backups\"")
+}
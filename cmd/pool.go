@@ -0,0 +1,130 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/docker/docker/client"
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/adakailabs/gocard/config"
+	"github.com/adakailabs/gocard/node"
+	"github.com/adakailabs/gocard/pool"
+
+	"github.com/spf13/cobra"
+)
+
+var poolKeysDir string
+var poolNodeContainer bool
+
+// poolCmd represents the pool command
+var poolCmd = &cobra.Command{
+	Use:   "pool",
+	Short: "Manage the stake pool keys",
+}
+
+// poolKeysCmd represents the pool keys command
+var poolKeysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Manage the stake pool key set",
+}
+
+// poolKeysGenerateCmd represents the pool keys generate command
+var poolKeysGenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Generate the payment, stake, cold, VRF and KES keys of a pool",
+	Long: `Generate the full key set of a stake pool with cardano-cli: payment and
+stake keys and addresses, cold keys and the operational certificate issue
+counter, VRF and KES keys. cardano-cli runs in a throwaway container of
+docker_image without network, or with --node-container in the running node
+container.
+
+The keys are written to pool.keys_dir (default pool-keys next to
+gocard.yaml) or --dir, which must not exist or be empty:
+
+  payment/  payment.skey payment.vkey payment.addr
+  stake/    stake.skey stake.vkey stake.addr
+  cold/     cold.skey cold.vkey cold.counter
+  node/     vrf.skey vrf.vkey kes.skey kes.vkey
+  manifest.json
+
+Directories are 0700, signing keys and the counter 0600. manifest.json
+describes each file with its checksum. Set pool.cli_era (e.g. latest) for
+cardano-cli versions with era commands. Move the cold, payment and stake
+signing keys offline once the pool is registered.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		c := config.New()
+		dir := poolDir(c)
+		networkArgs, err := c.NetworkArgs()
+		if err != nil {
+			logrus.Fatal(errors.ErrorStack(errors.Annotate(err, "run gocard node init first")))
+		}
+
+		ctx := context.Background()
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			logrus.Fatal(errors.ErrorStack(err))
+		}
+		runner, err := node.NewContainerCli(ctx, cli, c, poolNodeContainer)
+		if err != nil {
+			logrus.Fatal(errors.ErrorStack(err))
+		}
+		m, err := pool.Generate(ctx, runner, dir, pool.Options{Network: networkArgs, Era: c.Pool.CliEra})
+		if closeErr := runner.Close(ctx); closeErr != nil {
+			logrus.Error(errors.ErrorStack(closeErr))
+		}
+		if err != nil {
+			logrus.Fatal(errors.ErrorStack(err))
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "FILE\tMODE\tDESCRIPTION")
+		for _, f := range m.Files {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", f.Path, f.Mode, f.Description)
+		}
+		w.Flush()
+
+		logrus.Info("pool id: ", m.PoolID)
+		logrus.Info("key set written to: ", dir)
+		logrus.Infof("producer_keys: kes_key %s, vrf_key %s",
+			filepath.Join(dir, m.Find(pool.RoleKES, pool.KindSigningKey).Path),
+			filepath.Join(dir, m.Find(pool.RoleVRF, pool.KindSigningKey).Path))
+	},
+}
+
+// poolDir is the key set directory: --dir or pool.keys_dir.
+func poolDir(c *config.Config) string {
+	if poolKeysDir != "" {
+		return poolKeysDir
+	}
+	return c.Pool.KeysDir
+}
+
+func init() {
+	rootCmd.AddCommand(poolCmd)
+	poolCmd.AddCommand(poolKeysCmd)
+	poolKeysCmd.AddCommand(poolKeysGenerateCmd)
+
+	poolCmd.PersistentFlags().StringVar(&poolKeysDir, "dir", "", "key set directory, pool.keys_dir by default")
+	poolCmd.PersistentFlags().BoolVar(&poolNodeContainer, "node-container", false,
+		"run cardano-cli in the running node container instead of a throwaway one without network")
+}
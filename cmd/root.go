@@ -26,12 +26,15 @@ import (
 	"github.com/adakailabs/gocard/config"
 
 	"github.com/spf13/cobra"
-
-	homedir "github.com/mitchellh/go-homedir"
-	"github.com/spf13/viper"
 )
 
 var cfgFile string
+var profiles []string
+
+// annotationKeepReferences marks commands that load the configuration
+// without resolving file:, env: and secret: references, so a broken
+// reference does not stop them.
+const annotationKeepReferences = "gocard_keep_references"
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
@@ -46,6 +49,9 @@ to quickly create a Cobra application.`,
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	//	Run: func(cmd *cobra.Command, args []string) { },
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		initConfig(cmd)
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -58,52 +64,37 @@ func Execute() {
 }
 
 func init() {
-	cobra.OnInitialize(initConfig)
-
 	// Here you will define your flags and configuration settings.
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.gocard.yaml)")
+	rootCmd.PersistentFlags().StringSliceVar(&profiles, "profile", nil,
+		"profile overlays merged over the config file in order, e.g. --profile staging (gocard.staging.yaml)")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
 
-// initConfig reads in config file and ENV variables if set.
-func initConfig() {
-	if cfgFile != "" {
-		// Use config file from the flag.
-		viper.SetConfigFile(cfgFile)
-	} else {
-		// Find home directory.
-		home, err := homedir.Dir()
-		if err != nil {
-			fmt.Println(err)
-			os.Exit(1)
-		}
-
-		// Search config in home directory with name ".gocard" (without extension).
-		viper.AddConfigPath(fmt.Sprintf("%s/cardano-node/config", home))
-		viper.AddConfigPath("./")
-		viper.AddConfigPath("/etc/cardano")
-		viper.SetConfigName("gocard")
+// initConfig reads in config file, profile overlays and ENV variables if set.
+func initConfig(cmd *cobra.Command) {
+	load := config.Load
+	if keepsReferences(cmd) {
+		load = config.LoadReferences
 	}
-
-	viper.AutomaticEnv() // read in environment variables that match
-
-	// If a config file is found, read it in.
-	if err := viper.ReadInConfig(); err == nil {
-		logrus.Info("Using config file:", viper.ConfigFileUsed())
+	if err := load(cfgFile, profiles); err != nil {
+		logrus.Fatal(errors.ErrorStack(err))
 	}
-	if _, err := os.Stat(config.GocardPidFile); err == nil {
-		logrus.Info("found docker ID")
-		viper.SetConfigFile(config.GocardPidFile)
-		if err := viper.MergeInConfig(); err != nil {
-			err = errors.Annotatef(err, "merging viper config %s", config.GocardPidFile)
-			panic(err.Error())
+}
+
+// keepsReferences reports whether cmd or one of its parents is annotated
+// with annotationKeepReferences.
+func keepsReferences(cmd *cobra.Command) bool {
+	for ; cmd != nil; cmd = cmd.Parent() {
+		if _, ok := cmd.Annotations[annotationKeepReferences]; ok {
+			return true
 		}
-		logrus.Info("docker ID : ", viper.GetString("container_id"))
 	}
+	return false
 }
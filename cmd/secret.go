@@ -0,0 +1,133 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh/terminal"
+
+	"github.com/adakailabs/gocard/config"
+
+	"github.com/spf13/cobra"
+)
+
+// secretCmd represents the config secret command
+var secretCmd = &cobra.Command{
+	Use:   "secret",
+	Short: "Manage the encrypted secrets file",
+	Long: fmt.Sprintf(`Manage the encrypted secrets file referenced from gocard.yaml with
+secret:NAME values. The file is encrypted with the passphrase in %s
+and defaults to gocard.secrets next to gocard.yaml (see secrets_file).
+
+Other references resolved when the configuration is loaded are
+file:/path (contents of a file) and env:NAME (an environment variable).
+Resolved values are never logged and are masked by "gocard config show".
+The secret commands do not resolve references, so a missing secret can be
+added with "gocard config secret set".`, config.SecretsPassphraseEnv),
+	Annotations: map[string]string{annotationKeepReferences: ""},
+}
+
+// secretSetCmd represents the config secret set command
+var secretSetCmd = &cobra.Command{
+	Use:   "set NAME [VALUE]",
+	Short: "Add or replace a secret, the value is read from stdin when not given",
+	Args:  cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		value := ""
+		if len(args) == 2 {
+			value = args[1]
+		} else {
+			var err error
+			if value, err = readSecretValue(args[0]); err != nil {
+				logrus.Fatal(errors.ErrorStack(err))
+			}
+		}
+
+		secrets, err := config.ReadSecrets()
+		if err != nil {
+			logrus.Fatal(errors.ErrorStack(err))
+		}
+		secrets[args[0]] = value
+		if err = config.WriteSecrets(secrets); err != nil {
+			logrus.Fatal(errors.ErrorStack(err))
+		}
+		logrus.Infof("secret %s written to %s", args[0], config.SecretsFilePath())
+	},
+}
+
+// secretListCmd represents the config secret list command
+var secretListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the names of the stored secrets",
+	Run: func(cmd *cobra.Command, args []string) {
+		names, err := config.SecretNames()
+		if err != nil {
+			logrus.Fatal(errors.ErrorStack(err))
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+	},
+}
+
+// secretRmCmd represents the config secret rm command
+var secretRmCmd = &cobra.Command{
+	Use:   "rm NAME",
+	Short: "Remove a secret",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		secrets, err := config.ReadSecrets()
+		if err != nil {
+			logrus.Fatal(errors.ErrorStack(err))
+		}
+		if _, ok := secrets[args[0]]; !ok {
+			logrus.Fatalf("secret %s not found", args[0])
+		}
+		delete(secrets, args[0])
+		if err = config.WriteSecrets(secrets); err != nil {
+			logrus.Fatal(errors.ErrorStack(err))
+		}
+	},
+}
+
+func readSecretValue(name string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if terminal.IsTerminal(fd) {
+		fmt.Printf("value for %s: ", name)
+		value, err := terminal.ReadPassword(fd)
+		fmt.Println()
+		return string(value), errors.Annotate(err, "reading secret")
+	}
+
+	value, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && value == "" {
+		return "", errors.Annotate(err, "reading secret from stdin")
+	}
+	return strings.TrimRight(value, "\r\n"), nil
+}
+
+func init() {
+	configCmd.AddCommand(secretCmd)
+	secretCmd.AddCommand(secretSetCmd)
+	secretCmd.AddCommand(secretListCmd)
+	secretCmd.AddCommand(secretRmCmd)
+}
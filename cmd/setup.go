@@ -0,0 +1,75 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"os"
+
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/adakailabs/gocard/setup"
+
+	"github.com/spf13/cobra"
+)
+
+var setupOptions = &setup.Options{}
+
+// setupCmd represents the setup command
+var setupCmd = &cobra.Command{
+	Use:   "setup",
+	Short: "Interactively create a gocard.yaml file",
+	Long: `Create a gocard.yaml file by answering a few questions: node role, network,
+pool name and ticker, ports and paths. Port availability and docker
+connectivity are checked along the way and the resulting file is validated
+before it is written.
+
+With --non-interactive no questions are asked, the values are taken from
+the flags, e.g.:
+
+  gocard setup --non-interactive --role relay --pool-name MyPool --pool-ticker MYPL`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := setup.Run(setupOptions, os.Stdin, os.Stdout); err != nil {
+			logrus.Fatal(errors.ErrorStack(err))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(setupCmd)
+
+	flags := setupCmd.Flags()
+	flags.StringVarP(&setupOptions.Output, "output", "o", "gocard.yaml", "file to write")
+	flags.BoolVar(&setupOptions.NonInteractive, "non-interactive", false, "do not prompt, take every value from flags")
+	flags.BoolVar(&setupOptions.Force, "force", false, "overwrite the output file if it exists")
+	flags.BoolVar(&setupOptions.SkipDockerCheck, "skip-docker-check", false, "do not check docker connectivity")
+
+	flags.StringVar(&setupOptions.Role, "role", setup.RoleRelay, "node role: relay or producer")
+	flags.StringVar(&setupOptions.Network, "network", "mainnet", "network: mainnet or private")
+	flags.StringVar(&setupOptions.PoolName, "pool-name", "", "pool name")
+	flags.StringVar(&setupOptions.PoolTicker, "pool-ticker", "", "pool ticker")
+	flags.StringVar(&setupOptions.ServerName, "server-name", "gocard", "server name, used for the container name")
+	flags.StringVar(&setupOptions.DockerImage, "docker-image", "adakailabs/cardano-node:latest", "cardano-node docker image")
+	flags.IntVar(&setupOptions.NodePort, "node-port", 3001, "cardano-node port")
+	flags.IntVar(&setupOptions.PrometheusPort, "prometheus-port", 12798, "cardano-node prometheus port")
+	flags.StringVar(&setupOptions.BaseLocal, "base-local", "/opt/cardano-node", "local cardano directory")
+	flags.StringVar(&setupOptions.BaseContainer, "base-container", "/home/lovelace/cardano-node", "cardano directory inside the container")
+
+	flags.StringVar(&setupOptions.ByronGenesis, "byron-genesis", "", "private network byron genesis file")
+	flags.StringVar(&setupOptions.ShelleyGenesis, "shelley-genesis", "", "private network shelley genesis file")
+	flags.StringVar(&setupOptions.AlonzoGenesis, "alonzo-genesis", "", "private network alonzo genesis file")
+	flags.StringVar(&setupOptions.ConwayGenesis, "conway-genesis", "", "private network conway genesis file")
+}
@@ -25,7 +25,13 @@ import (
 var startCmd = &cobra.Command{
 	Use:   "start",
 	Short: "start a node, based on configuration set in gocard.yaml file",
-	Long:  `Start a node, based on the configuration set in the gocard.yaml file.`,
+	Long: `Start a node, based on the configuration set in the gocard.yaml file.
+
+While the node runs, changes to gocard.yaml (and the active profile files)
+are picked up automatically, or on SIGHUP. Each change is applied according
+to what it affects: log_level is applied live, topology and node config
+settings restart the node and anything else (image, ports, paths) recreates
+the container.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		node.Start(config.New())
 	},
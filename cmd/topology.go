@@ -0,0 +1,257 @@
+/*
+Copyright © 2021 NAME HERE <EMAIL ADDRESS>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/adakailabs/gocard/config"
+	"github.com/adakailabs/gocard/node"
+	"github.com/adakailabs/gocard/topology"
+	"github.com/docker/docker/client"
+
+	"github.com/spf13/cobra"
+)
+
+var convertOut string
+var convertPublic []string
+var convertTrustable bool
+var convertUseLedgerAfterSlot int64
+var probeOpts topology.ProbeOptions
+var probeWrite int
+
+// topologyCmd represents the topology command
+var topologyCmd = &cobra.Command{
+	Use:   "topology",
+	Short: "Work with cardano-node topology files",
+}
+
+// topologyConvertCmd represents the topology convert command
+var topologyConvertCmd = &cobra.Command{
+	Use:   "convert legacy-topology.json",
+	Short: "Convert a legacy topology file to the P2P format",
+	Long: `Convert a legacy topology file (a Producers array) to the P2P format. Each
+producer becomes a local roots group keeping its valency, except the
+addresses given with --public which become public roots. The result is
+validated and written to --out, or printed.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		data, err := ioutil.ReadFile(args[0])
+		if err != nil {
+			logrus.Fatal(errors.ErrorStack(err))
+		}
+		file, err := topology.Parse(data)
+		if err != nil {
+			logrus.Fatal(errors.ErrorStack(err))
+		}
+		if file.Format != topology.FormatLegacy {
+			logrus.Fatalf("%s is not a legacy topology", args[0])
+		}
+		if err = file.Validate(); err != nil {
+			logrus.Fatal(errors.Annotate(err, args[0]).Error())
+		}
+
+		opts := topology.ConvertOptions{Public: convertPublic, Trustable: convertTrustable}
+		if cmd.Flags().Changed("use-ledger-after-slot") {
+			opts.UseLedgerAfterSlot = &convertUseLedgerAfterSlot
+		}
+		p2p := topology.ConvertLegacy(file.Legacy, opts)
+		if err = p2p.Validate(); err != nil {
+			logrus.Fatal(errors.Annotate(err, "converted topology").Error())
+		}
+
+		out, err := topology.Encode(p2p)
+		if err != nil {
+			logrus.Fatal(errors.ErrorStack(err))
+		}
+		if convertOut == "" {
+			os.Stdout.Write(out)
+			return
+		}
+		if err = ioutil.WriteFile(convertOut, out, 0644); err != nil {
+			logrus.Fatal(errors.ErrorStack(err))
+		}
+		logrus.Info("p2p topology written to: ", convertOut)
+	},
+}
+
+// topologyUpdateCmd represents the topology update command
+var topologyUpdateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Register the relay with the topology updater and refresh its peers",
+	Long: `Register the running relay with the topology_updater endpoint, using the
+block height of its tip, fetch the registered relays and regenerate
+topology.json with them and the custom peers. With the on_change restart
+policy the node container is restarted when the topology changed. gocard
+start does this every topology_updater.interval on its own.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		c := config.New()
+		if !c.TopologyUpdater.Enabled {
+			logrus.Fatal("topology_updater is not enabled for this node")
+		}
+		if !c.ContainerIsUP {
+			logrus.Fatal("the node container is not running")
+		}
+
+		ctx := context.Background()
+		cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if err != nil {
+			logrus.Fatal(errors.ErrorStack(err))
+		}
+		changed, err := node.UpdateTopology(ctx, cli, c, c.ContainerID)
+		if err != nil {
+			logrus.Fatal(errors.ErrorStack(err))
+		}
+		if changed && c.TopologyUpdater.Restart == config.RestartOnChange {
+			logrus.Info("topology changed, restarting container with ID: ", c.ContainerID)
+			if err = cli.ContainerRestart(ctx, c.ContainerID, nil); err != nil {
+				logrus.Fatal(errors.ErrorStack(err))
+			}
+		}
+	},
+}
+
+// topologyProbeCmd represents the topology probe command
+var topologyProbeCmd = &cobra.Command{
+	Use:   "probe [address:port[@region] ...]",
+	Short: "Measure the latency of candidate peers and pick the best ones",
+	Long: `Measure the TCP connect latency and reachability of candidate peers,
+concurrently, and print them ranked. The candidates are the peers given as
+arguments, or else the peers of topology.json and the ones last fetched by
+the topology updater, which carry their region.
+
+With --write N the N fastest reachable peers of each region are kept and
+added to the topology.json generated from pool_layout for this relay. Without
+pool_layout --write is refused, the published topology is not replaced.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		c := config.New()
+		if probeWrite > 0 {
+			if err := c.CheckProbeWrite(); err != nil {
+				logrus.Fatal(err.Error())
+			}
+		}
+
+		var peers []topology.Peer
+		for _, arg := range args {
+			peer, err := topology.ParsePeer(arg)
+			if err != nil {
+				logrus.Fatal(err.Error())
+			}
+			peers = append(peers, peer)
+		}
+		if len(peers) == 0 {
+			var err error
+			if peers, err = c.ProbeCandidates(); err != nil {
+				logrus.Fatal(errors.ErrorStack(err))
+			}
+		}
+		if len(peers) == 0 {
+			logrus.Fatal("no candidate peers to probe")
+		}
+
+		logrus.Infof("probing %d peer(s)", len(peers))
+		results := topology.Probe(context.Background(), peers, probeOpts)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "RANK\tPEER\tREGION\tLATENCY\tFAILED")
+		for i, result := range results {
+			latency := "unreachable"
+			if result.Reachable {
+				latency = result.Latency.Round(time.Microsecond).String()
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%d/%d\n", i+1, result.Peer, topology.Region(result.Peer),
+				latency, result.Failures, result.Attempts)
+		}
+		w.Flush()
+
+		if probeWrite <= 0 {
+			return
+		}
+		best := topology.BestPerRegion(results, probeWrite)
+		changed, err := c.WriteProbedPeers(best)
+		if err != nil {
+			logrus.Fatal(errors.ErrorStack(err))
+		}
+		logrus.Infof("%d peer(s) kept, topology changed: %t; restart the node to apply it", len(best), changed)
+	},
+}
+
+// topologyCheckCmd represents the topology check command
+var topologyCheckCmd = &cobra.Command{
+	Use:   "check [topology.json]",
+	Short: "Check a topology file for mistakes",
+	Long: `Check topology.json, or the given file, for duplicate peers, host names
+that do not resolve, invalid ports, peers pointing to this node itself
+(cardano_host_address and cardano_port, or its pool_layout entry) and the
+pool's producer listed where a relay shares its peers. gocard start runs
+the same check and refuses to start on errors.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c := config.New()
+
+		file := ""
+		if len(args) == 1 {
+			file = args[0]
+		}
+		issues, err := c.CheckTopology(context.Background(), file)
+		if err != nil {
+			logrus.Fatal(errors.ErrorStack(err))
+		}
+		if len(issues) == 0 {
+			logrus.Info("topology OK")
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "SEVERITY\tWHERE\tISSUE")
+		for _, issue := range issues {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", issue.Severity, issue.Where, issue.Message)
+		}
+		w.Flush()
+
+		if topology.HasErrors(issues) {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(topologyCmd)
+	topologyCmd.AddCommand(topologyConvertCmd)
+	topologyCmd.AddCommand(topologyUpdateCmd)
+	topologyCmd.AddCommand(topologyProbeCmd)
+	topologyCmd.AddCommand(topologyCheckCmd)
+
+	topologyConvertCmd.Flags().StringVarP(&convertOut, "out", "o", "", "write the P2P topology to this file instead of printing it")
+	topologyConvertCmd.Flags().StringSliceVar(&convertPublic, "public", nil,
+		"addresses that become public roots, e.g. relays-new.cardano-mainnet.iohk.io")
+	topologyConvertCmd.Flags().BoolVar(&convertTrustable, "trustable", false, "mark the local roots as trustable")
+	topologyConvertCmd.Flags().Int64Var(&convertUseLedgerAfterSlot, "use-ledger-after-slot", 0,
+		"use ledger peers after this slot, -1 never; not written when unset")
+
+	topologyProbeCmd.Flags().DurationVar(&probeOpts.Timeout, "timeout", 3*time.Second, "timeout of each connection attempt")
+	topologyProbeCmd.Flags().IntVar(&probeOpts.Attempts, "attempts", 3, "connections made to each peer, the fastest is kept")
+	topologyProbeCmd.Flags().IntVar(&probeOpts.Concurrency, "concurrency", 16, "peers probed at a time")
+	topologyProbeCmd.Flags().IntVar(&probeWrite, "write", 0, "keep the N fastest peers of each region in the generated topology")
+}
@@ -0,0 +1,13 @@
+//go:build release
+// +build release
+
+package config
+
+import "embed"
+
+// releaseBundle names every file of the mainnet bundle, so a release build
+// fails unless the bundle was pinned and populated with `make bundles`.
+//go:embed bundles/mainnet/SHA256SUMS bundles/mainnet/config.json bundles/mainnet/topology.json
+//go:embed bundles/mainnet/byron-genesis.json bundles/mainnet/shelley-genesis.json
+//go:embed bundles/mainnet/alonzo-genesis.json bundles/mainnet/conway-genesis.json
+var releaseBundle embed.FS
@@ -2,16 +2,10 @@ package config
 
 import (
 	"fmt"
-	"io"
-	"io/ioutil"
 	"log"
-	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
-	"time"
-
-	"github.com/tidwall/gjson"
-	"github.com/tidwall/sjson"
 
 	"github.com/sirupsen/logrus"
 
@@ -22,26 +16,23 @@ import (
 const NodeTypeRelay = "relay"
 const NodeTypeProducer = "producer"
 
-const cardanoConfigURL = "https://hydra.iohk.io/job/Cardano/iohk-nix/cardano-deployment/latest-finished/download/1/"
-const config = "mainnet-config.json"
+// cardanoConfigURL publishes the configuration set of every public network,
+// the %s is the network name.
+const cardanoConfigURL = "https://book.world.dev.cardano.org/environments/%s/"
+const config = "config.json"
 const newConfig = "config.json"
-const shelleyGenesis = "mainnet-shelley-genesis.json"
-const newShelleyGenesis = "mainnet-shelley-genesis.json"
-const byronGenesis = "mainnet-byron-genesis.json"
-const newByronGenesis = "mainnet-byron-genesis.json"
-const topology = "mainnet-topology.json"
+const topology = "topology.json"
 const newTopology = "topology.json"
 
+// cardanoConfigFiles are the files published under a fixed name. The
+// genesis files of every era are the ones config.json references.
 var cardanoConfigFiles = map[string]string{
-	config:         newConfig,
-	shelleyGenesis: newShelleyGenesis,
-	byronGenesis:   newByronGenesis,
-	topology:       newTopology,
+	config:   newConfig,
+	topology: newTopology,
 }
 
 func (c *Config) SetCardanoInit() {
 	configPath := fmt.Sprintf("%s/%s", c.CardanoBaseLocal, "config")
-	rtViewPath := fmt.Sprintf("%s/%s", c.CardanoBaseLocal, "rt-view")
 
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
 		if err := os.MkdirAll(configPath, os.ModePerm); err != nil {
@@ -50,29 +41,92 @@ func (c *Config) SetCardanoInit() {
 		}
 	}
 
-	if _, err := os.Stat(rtViewPath); os.IsNotExist(err) {
-		if err := os.MkdirAll(rtViewPath, os.ModePerm); err != nil {
-			err = errors.Annotatef(err, "creating dir: %s", configPath)
-			panic(err.Error())
+	if c.IsPrivateNetwork() {
+		if err := c.setPrivateNetworkInit(configPath); err != nil {
+			err = errors.Annotate(err, "initializing private network")
+			panic(errors.ErrorStack(err))
 		}
+		c.updateCardanoConfigOnInit()
+		c.updateTopologyOnInit()
+		c.verifyGenesisOnInit()
+		return
 	}
 
-	configURL := viper.GetString("cardano_latest_config")
-	if configURL == "" {
-		err := fmt.Errorf("cardano latest config URL not specified")
-		err = errors.Annotate(err, "")
+	source, err := c.ConfigSource()
+	if err != nil {
 		log.Fatal(errors.ErrorStack(err))
-	} else {
-		for urlName, newName := range cardanoConfigFiles {
-			err := downloadFile(newName, configPath, urlName)
-			if err != nil {
-				err = errors.Annotatef(err, "while downloading file: %s", newName)
-				panic(err.Error())
-			}
+	}
+	logrus.Info("cardano config source: ", source.Name())
+
+	if err := fetchConfigSet(source, configPath, true); err != nil {
+		panic(errors.ErrorStack(err))
+	}
+
+	c.updateCardanoConfigOnInit()
+	c.updateTopologyOnInit()
+	c.verifyGenesisOnInit()
+}
+
+// fetchConfigSet fetches config.json and the topology, then every genesis
+// file config.json references, into dir. Files already in dir are kept when
+// keepExisting is set.
+func fetchConfigSet(source ConfigSource, dir string, keepExisting bool) error {
+	fetch := func(sourceName, newName string) error {
+		filePath := fmt.Sprintf("%s/%s", dir, newName)
+		if _, err := os.Stat(filePath); err == nil && keepExisting {
+			logrus.Info("found file: ", filePath)
+			return nil
+		}
+		if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+			return errors.Annotatef(err, "creating dir: %s", filepath.Dir(filePath))
+		}
+		if err := source.Fetch(sourceName, filePath); err != nil {
+			return errors.Annotatef(err, "while fetching file: %s", newName)
+		}
+		return nil
+	}
+
+	for sourceName, newName := range cardanoConfigFiles {
+		if err := fetch(sourceName, newName); err != nil {
+			return err
+		}
+	}
+
+	refs, err := readGenesisRefs(fmt.Sprintf("%s/%s", dir, newConfig))
+	if err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		if filepath.IsAbs(ref.file) {
+			logrus.Warnf("%s genesis %s is an absolute path, not fetched", ref.era, ref.file)
+			continue
 		}
+		if clean := filepath.Clean(ref.file); clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+			return errors.Errorf("%s genesis %s is outside the config dir", ref.era, ref.file)
+		}
+		if err := fetch(filepath.Base(ref.file), ref.file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Config) updateCardanoConfigOnInit() {
+	if err := c.updateCardanoConfig(); err != nil {
+		panic(errors.ErrorStack(err))
 	}
+}
 
-	c.updateCardanoConfig()
+func (c *Config) updateTopologyOnInit() {
+	if _, err := c.updateTopology(); err != nil {
+		panic(errors.ErrorStack(err))
+	}
+}
+
+func (c *Config) verifyGenesisOnInit() {
+	if err := c.VerifyGenesisHashes(); err != nil {
+		panic(errors.ErrorStack(err))
+	}
 }
 
 func (c *Config) CheckCardanoConfigFiles() error {
@@ -83,7 +137,7 @@ func (c *Config) CheckCardanoConfigFiles() error {
 		return err
 	}
 
-	for _, newName := range cardanoConfigFiles {
+	for _, newName := range c.cardanoConfigFileNames() {
 		filePath := fmt.Sprintf("%s/%s", configPath, newName)
 		if _, err := os.Stat(filePath); os.IsNotExist(err) {
 			err = errors.Annotatef(err, "file %s not found in config dir", filePath)
@@ -94,121 +148,88 @@ func (c *Config) CheckCardanoConfigFiles() error {
 	return nil
 }
 
-func (c *Config) updateCardanoConfig() {
-	cardanoConfigDir := fmt.Sprintf("%s/config", c.CardanoBaseLocal)
-	cardanoConfigFile := fmt.Sprintf("%s/config.json", cardanoConfigDir)
-	var newJSON string
-	if _, err := os.Stat(cardanoConfigFile); err == nil {
-		jsonFile, err := ioutil.ReadFile(cardanoConfigFile)
-		if err != nil {
-			err = errors.Annotate(err, "could not read cardano config file")
-			panic(errors.ErrorStack(err))
-		}
-		defaultScribes := gjson.Get(string(jsonFile), "defaultScribes").Array()
-		skipDefaults := false
-		for _, defaults := range defaultScribes {
-			defaultsWithType := defaults.Array()
-			for _, element := range defaultsWithType {
-				elementWithType := element.Str
-				if elementWithType == "FileSK" {
-					skipDefaults = true
-				}
-			}
-		}
+// RefreshNodeConfig re-applies the gocard managed settings to the node
+// configuration files and regenerates the topology, e.g. after gocard.yaml
+// changed.
+func (c *Config) RefreshNodeConfig() error {
+	if err := c.updateCardanoConfig(); err != nil {
+		return err
+	}
+	_, err := c.updateTopology()
+	return err
+}
 
-		nodeType := NodeTypeRelay
-		if c.IsProducer {
-			nodeType = NodeTypeProducer
-		}
+func (c *Config) cardanoConfigFileNames() []string {
+	if c.IsPrivateNetwork() {
+		return c.privateConfigFileNames()
+	}
 
-		nodeName := fmt.Sprintf("%s-%s", c.ContainerName, nodeType)
-
-		cardanoLogPath := fmt.Sprintf("%s/log/cardano-%s.log", c.CardanoBaseContainer, nodeName)
-
-		if !skipDefaults {
-			element := `[
-    %s,
-    [
-      "FileSK",
-      "%s"
-    ]
-  ]`
-			newJSONElement := fmt.Sprintf(element, defaultScribes[0].Raw, cardanoLogPath)
-			newJSON, err = sjson.SetRaw(string(jsonFile), "defaultScribes", newJSONElement)
-			if err != nil {
-				panic(err.Error())
-			}
-		}
+	names := make([]string, 0, len(cardanoConfigFiles)+4)
+	for _, newName := range cardanoConfigFiles {
+		names = append(names, newName)
+	}
 
-		setupScribes := gjson.Get(newJSON, "setupScribes").Array()
-		skipSetup := false
-		for _, setupUps := range setupScribes {
-			if strings.Contains(setupUps.Raw, "FileSK") {
-				skipSetup = true
-			}
-		}
-		time.Sleep(time.Second)
-		if !skipSetup {
-			element := `[
-    %s,
-    {
-      "scFormat": "ScText",
-      "scKind": "FileSK",
-      "scName": "%s",
-      "scRotation": null
-    }
-  ]`
-			newJSONElement := fmt.Sprintf(element, setupScribes[0].Raw, cardanoLogPath)
-			newJSON, err = sjson.SetRaw(newJSON, "setupScribes", newJSONElement)
-			if err != nil {
-				panic(err.Error())
-			}
+	configFile := fmt.Sprintf("%s/config/%s", c.CardanoBaseLocal, newConfig)
+	refs, err := readGenesisRefs(configFile)
+	if err != nil {
+		// a missing or broken config.json is reported when it is checked
+		return names
+	}
+	for _, ref := range refs {
+		if !filepath.IsAbs(ref.file) {
+			names = append(names, ref.file)
 		}
+	}
+	return names
+}
 
-		prometheusJSON := fmt.Sprintf(`[
-    "%s",
-    %d
-  ]`,
-			viper.GetString("cardano_hasprometheus.address"),
-			viper.GetInt("cardano_hasprometheus.port"))
+func (c *Config) updateCardanoConfig() error {
+	cardanoConfigFile := fmt.Sprintf("%s/config/%s", c.CardanoBaseLocal, newConfig)
+	if _, err := os.Stat(cardanoConfigFile); err != nil {
+		return nil
+	}
 
-		newJSON, err = sjson.SetRaw(newJSON, "hasPrometheus", prometheusJSON)
-		if err != nil {
-			panic(err.Error())
-		}
+	nodeConfig, err := LoadNodeConfig(cardanoConfigFile)
+	if err != nil {
+		return errors.Annotate(err, "could not read cardano config file")
+	}
+	if err = c.applyNodeConfig(nodeConfig); err != nil {
+		return err
+	}
+	if err = nodeConfig.Save(cardanoConfigFile); err != nil {
+		return err
+	}
 
-		if err := ioutil.WriteFile(cardanoConfigFile, []byte(newJSON), os.ModePerm); err != nil {
-			panic(errors.Annotatef(err, "writing to file %s", cardanoConfigFile).Error())
-		}
+	if c.CardanoTracer.Enabled {
+		return c.updateTracerConfig()
 	}
+	return nil
 }
 
-func downloadFile(newFileName, dirPath, urlFileName string) error {
-	filePath := fmt.Sprintf("%s/%s", dirPath, newFileName)
-	url := fmt.Sprintf("%s%s", cardanoConfigURL, urlFileName)
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		logrus.Info("downloading file from: ", url)
-		logrus.Info("writing to: ", filePath)
-		// Get the data
-		resp, err := http.Get(fmt.Sprintf("%s%s", cardanoConfigURL, urlFileName))
-		if err != nil {
-			return err
-		}
-		defer resp.Body.Close()
-
-		// Create the file
-		out, err := os.Create(filePath)
-		if err != nil {
-			return err
-		}
-		defer out.Close()
+// applyNodeConfig sets the gocard managed settings of a node configuration.
+func (c *Config) applyNodeConfig(nodeConfig *NodeConfig) error {
+	nodeType := NodeTypeRelay
+	if c.IsProducer {
+		nodeType = NodeTypeProducer
+	}
+	nodeName := fmt.Sprintf("%s-%s", c.ContainerName, nodeType)
 
-		// Write the body to file
-		_, err = io.Copy(out, resp.Body)
+	cardanoLogPath := fmt.Sprintf("%s/log/cardano-%s.log", c.CardanoBaseContainer, nodeName)
+	if err := applyLogSettings(nodeConfig, nodeConfig.SetFileScribe(cardanoLogPath)); err != nil {
 		return err
 	}
 
-	logrus.Info("found file: ", filePath)
+	nodeConfig.HasPrometheus = &Endpoint{
+		Host: viper.GetString("cardano_hasprometheus.address"),
+		Port: viper.GetInt("cardano_hasprometheus.port"),
+	}
 
-	return nil
+	if c.CardanoTracer.Enabled {
+		c.applyTraceOptions(nodeConfig)
+	}
+	if err := applyTopologyFormat(nodeConfig); err != nil {
+		return err
+	}
+
+	return c.applyTracers(nodeConfig)
 }
@@ -0,0 +1,280 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/go-connections/nat"
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const tracerDirName = "tracer"
+const tracerConfigName = "tracer-config.json"
+const tracerSocketName = "tracer.socket"
+const tracerContainerDir = "/opt/cardano/tracer"
+const defaultRTViewPort = 3300
+const defaultRTViewAddress = "127.0.0.1"
+const defaultTracerRotationFrequencySecs = 60
+
+const TracerLogMachine = "machine"
+const TracerLogHuman = "human"
+
+// tracerLogFormats maps the cardano_tracer.log_format values to the
+// cardano-tracer ones.
+var tracerLogFormats = map[string]string{
+	TracerLogMachine: "ForMachine",
+	TracerLogHuman:   "ForHuman",
+}
+
+// defaultTraceOption is the root namespace configuration written when the
+// node configuration has none: forward everything to cardano-tracer.
+var defaultTraceOption = TraceOption{
+	Severity: "Notice",
+	Detail:   "DNormal",
+	Backends: []string{"Stdout MachineFormat", "EKGBackend", "Forwarder"},
+}
+
+// CardanoTracer is the cardano-tracer sidecar. When enabled the node uses
+// the new tracing system and forwards its traces over a socket in the tracer
+// directory, which cardano-tracer turns into log files and serves in RTView.
+type CardanoTracer struct {
+	Enabled         bool
+	Image           string
+	Entrypoint      []string
+	ContainerName   string
+	LocalDir        string
+	LogFormat       string
+	RTViewEnabled   bool
+	RTViewAddress   string
+	RTViewPort      int
+	TraceOptions    []TraceOptionSetting
+	HostConfig      *container.HostConfig
+	ContainerConfig *container.Config
+}
+
+// TracerRotation is the rotation section of the cardano-tracer
+// configuration. Unlike the node it also needs how often the logs are
+// checked.
+type TracerRotation struct {
+	RpFrequencySecs int   `json:"rpFrequencySecs"`
+	RpLogLimitBytes int64 `json:"rpLogLimitBytes"`
+	RpKeepFilesNum  int   `json:"rpKeepFilesNum"`
+	RpMaxAgeHours   int   `json:"rpMaxAgeHours"`
+}
+
+// TraceOptionSetting is an entry of cardano_tracer.trace_options. It is a
+// list rather than a map as namespaces are case sensitive and dotted.
+type TraceOptionSetting struct {
+	Namespace    string   `mapstructure:"namespace"`
+	Severity     string   `mapstructure:"severity"`
+	Detail       string   `mapstructure:"detail"`
+	Backends     []string `mapstructure:"backends"`
+	MaxFrequency *float64 `mapstructure:"max_frequency"`
+}
+
+func (c *Config) SetCardanoTracer() {
+	c.CardanoTracer = CardanoTracer{
+		Enabled:       viper.GetBool("cardano_tracer.enabled"),
+		Image:         viper.GetString("cardano_tracer.image"),
+		Entrypoint:    viper.GetStringSlice("cardano_tracer.entrypoint"),
+		ContainerName: fmt.Sprintf("%s-tracer", c.ContainerName),
+		LocalDir:      filepath.Join(c.CardanoBaseLocal, tracerDirName),
+		LogFormat:     viper.GetString("cardano_tracer.log_format"),
+		RTViewEnabled: true,
+		RTViewAddress: viper.GetString("cardano_tracer.rtview.address"),
+		RTViewPort:    viper.GetInt("cardano_tracer.rtview.port"),
+	}
+	t := &c.CardanoTracer
+	if !t.Enabled {
+		return
+	}
+
+	if t.Image == "" {
+		t.Image = c.DockerImage
+	}
+	if len(t.Entrypoint) == 0 {
+		t.Entrypoint = []string{"cardano-tracer"}
+	}
+	if t.LogFormat == "" {
+		t.LogFormat = TracerLogMachine
+	}
+	if _, ok := tracerLogFormats[t.LogFormat]; !ok {
+		err := errors.Errorf("cardano_tracer.log_format must be %s or %s, found: %s",
+			TracerLogMachine, TracerLogHuman, t.LogFormat)
+		panic(errors.ErrorStack(err))
+	}
+	if viper.IsSet("cardano_tracer.rtview.enabled") {
+		t.RTViewEnabled = viper.GetBool("cardano_tracer.rtview.enabled")
+	}
+	if t.RTViewAddress == "" {
+		t.RTViewAddress = defaultRTViewAddress
+	}
+	if t.RTViewPort == 0 {
+		t.RTViewPort = defaultRTViewPort
+	}
+	if err := viper.UnmarshalKey("cardano_tracer.trace_options", &t.TraceOptions); err != nil {
+		err = errors.Annotate(err, "reading cardano_tracer.trace_options")
+		panic(errors.ErrorStack(err))
+	}
+
+	t.setContainer()
+}
+
+// setContainer builds the docker configuration of the sidecar. The tracer
+// directory is mounted read-write, the socket and the logs live in it.
+func (t *CardanoTracer) setContainer() {
+	portSet := nat.PortSet{}
+	portMap := nat.PortMap{}
+	if t.RTViewEnabled {
+		port := nat.Port(fmt.Sprintf("%d/tcp", t.RTViewPort))
+		portSet[port] = struct{}{}
+		portMap[port] = []nat.PortBinding{{HostIP: t.RTViewAddress, HostPort: strconv.Itoa(t.RTViewPort)}}
+	}
+
+	t.HostConfig = &container.HostConfig{
+		Mounts: []mount.Mount{
+			{
+				Type:   mount.TypeBind,
+				Source: t.LocalDir,
+				Target: tracerContainerDir,
+			},
+		},
+		PortBindings: portMap,
+	}
+	t.ContainerConfig = &container.Config{
+		Hostname:     t.ContainerName,
+		Image:        t.Image,
+		Entrypoint:   t.Entrypoint,
+		Cmd:          []string{"--config", fmt.Sprintf("%s/%s", tracerContainerDir, tracerConfigName)},
+		ExposedPorts: portSet,
+	}
+}
+
+// portSpecs returns the port the tracer container publishes, RTView's.
+func (t *CardanoTracer) portSpecs() []string {
+	if !t.Enabled || !t.RTViewEnabled {
+		return nil
+	}
+	port := strconv.Itoa(t.RTViewPort)
+	return []string{fmt.Sprintf("%s:%s/tcp", net.JoinHostPort(t.RTViewAddress, port), port)}
+}
+
+// tracerRotation returns the rotation of the node log, set with
+// cardano_log.rotation, checked every cardano_tracer.rotation_frequency_secs.
+// It is nil when rotation is disabled.
+func tracerRotation() (*TracerRotation, error) {
+	rotation, err := logRotation()
+	if err != nil || rotation == nil {
+		return nil, err
+	}
+
+	frequency := defaultTracerRotationFrequencySecs
+	if viper.IsSet("cardano_tracer.rotation_frequency_secs") {
+		frequency = viper.GetInt("cardano_tracer.rotation_frequency_secs")
+	}
+	if frequency <= 0 {
+		return nil, errors.Errorf("cardano_tracer.rotation_frequency_secs must be positive, found: %d", frequency)
+	}
+	return &TracerRotation{
+		RpFrequencySecs: frequency,
+		RpLogLimitBytes: rotation.RpLogLimitBytes,
+		RpKeepFilesNum:  rotation.RpKeepFilesNum,
+		RpMaxAgeHours:   rotation.RpMaxAgeHours,
+	}, nil
+}
+
+// tracerSocketArgs are the node arguments connecting it to cardano-tracer.
+func (c *Config) tracerSocketArgs() []string {
+	return []string{
+		"--tracer-socket-path-connect",
+		fmt.Sprintf("%s/%s/%s", c.CardanoBaseContainer, tracerDirName, tracerSocketName),
+	}
+}
+
+func (c *Config) logCardanoTracer() {
+	t := c.CardanoTracer
+	logrus.Infof("cardano-tracer: image %s, dir %s", t.Image, t.LocalDir)
+	if t.RTViewEnabled {
+		logrus.Infof("RTView: http://%s:%d", t.RTViewAddress, t.RTViewPort)
+	}
+}
+
+// applyTraceOptions switches the node configuration to the new tracing
+// system: the default root namespace when it has none, then the
+// cardano_tracer.trace_options, each replacing its namespace.
+func (c *Config) applyTraceOptions(nodeConfig *NodeConfig) {
+	enabled := true
+	nodeConfig.UseTraceDispatcher = &enabled
+	nodeConfig.TraceOptionNodeName = c.ContainerName
+
+	if nodeConfig.TraceOptions == nil {
+		nodeConfig.TraceOptions = map[string]TraceOption{}
+	}
+	if _, ok := nodeConfig.TraceOptions[""]; !ok {
+		nodeConfig.TraceOptions[""] = defaultTraceOption
+	}
+	for _, setting := range c.CardanoTracer.TraceOptions {
+		nodeConfig.TraceOptions[setting.Namespace] = TraceOption{
+			Severity:     setting.Severity,
+			Detail:       setting.Detail,
+			Backends:     setting.Backends,
+			MaxFrequency: setting.MaxFrequency,
+		}
+	}
+}
+
+// updateTracerConfig writes the cardano-tracer configuration to the tracer
+// directory.
+func (c *Config) updateTracerConfig() error {
+	t := c.CardanoTracer
+	if err := os.MkdirAll(filepath.Join(t.LocalDir, "logs"), os.ModePerm); err != nil {
+		return errors.Annotatef(err, "creating dir: %s", t.LocalDir)
+	}
+
+	magic, err := c.networkMagic()
+	if err != nil {
+		return err
+	}
+
+	tracerConfig := map[string]interface{}{
+		"networkMagic": magic,
+		"network": map[string]string{
+			"tag":      "AcceptAt",
+			"contents": fmt.Sprintf("%s/%s", tracerContainerDir, tracerSocketName),
+		},
+		"logging": []map[string]string{{
+			"logRoot":   fmt.Sprintf("%s/logs", tracerContainerDir),
+			"logMode":   "FileMode",
+			"logFormat": tracerLogFormats[t.LogFormat],
+		}},
+	}
+	rotation, err := tracerRotation()
+	if err != nil {
+		return err
+	}
+	if rotation != nil {
+		tracerConfig["rotation"] = rotation
+	}
+	if t.RTViewEnabled {
+		tracerConfig["hasRTView"] = map[string]interface{}{
+			"epHost": "0.0.0.0",
+			"epPort": t.RTViewPort,
+		}
+	}
+
+	data, err := json.MarshalIndent(tracerConfig, "", "  ")
+	if err != nil {
+		return errors.Annotate(err, "encoding tracer config")
+	}
+	configFile := filepath.Join(t.LocalDir, tracerConfigName)
+	return errors.Annotatef(writeFile(bytes.NewReader(data), configFile), "writing %s", configFile)
+}
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"github.com/juju/errors"
 	"os"
-	"strings"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/client"
@@ -40,6 +39,16 @@ type Config struct {
 	CardanoPort          string
 	CardanoHostAddress   string
 	CardanoCmdStrings    []string
+	CardanoNetwork       string
+	PrivateNetwork       PrivateNetwork
+	CardanoKeysContainer string
+	ProducerKeys         ProducerKeys
+	CardanoExtraArgs     []string
+	ContainerEnv         []string
+	ExtraMounts          []ExtraMount
+	CardanoTracer        CardanoTracer
+	TopologyUpdater      TopologyUpdater
+	Pool                 Pool
 
 	ContainerID   string
 	ContainerIsUP bool
@@ -47,6 +56,17 @@ type Config struct {
 
 
 func New() *Config {
+	c := readConfig()
+	c.SetCardanoBaseLocal()
+	c.CheckDockerContainerUp()
+	c.LogConfig()
+	return c
+}
+
+// readConfig reads the settings into a Config without touching the host: no
+// directory is created, docker is not queried and the pid file is left
+// alone.
+func readConfig() *Config {
 	c := &Config{}
 
 	c.NodeName = viper.GetString("node_name")
@@ -54,17 +74,39 @@ func New() *Config {
 	c.DockerImage = viper.GetString("docker_image")
 	c.IsProducer = viper.GetBool("service_is_producer")
 	c.ContainerName = viper.GetString("server_name")
+	c.SetPrivateNetwork()
 	c.SetCardanoPaths()
+	c.SetProducerKeys()
+	c.SetExtras()
 	c.SetExposedPorts()
 	c.SetMount()
 	c.SetContainerName()
+	c.SetCardanoTracer()
+	c.SetTopologyUpdater()
+	c.SetPool()
 	c.SetCmdStrings()
 	c.SetHostConfig()
 	c.SetContainerConfig()
-	c.LogConfig()
 	return c
 }
 
+// Build validates the configuration for a running node: it reads it like
+// New, without its side effects, and returns an error instead of panicking
+// on an invalid value so the node can keep its current configuration. The
+// container is the one recorded in the pid file.
+func Build() (c *Config, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			c, err = nil, errors.Errorf("invalid configuration: %v", r)
+		}
+	}()
+	c = readConfig()
+	c.ContainerID = viper.GetString("container_id")
+	return c, nil
+}
+
+// LogConfig logs the node settings. Values resolved from secret references
+// are masked by the hook installed by ResolveSecrets.
 func (c *Config) LogConfig() {
 	containerType := "relay"
 	if c.IsProducer {
@@ -72,6 +114,7 @@ func (c *Config) LogConfig() {
 	}
 	logrus.Info("container type: ", containerType)
 	logrus.Info("docker image: ", c.DockerImage)
+	logrus.Info("cardano network: ", c.CardanoNetwork)
 
 	logrus.Info("cardano base container: ", c.CardanoBaseContainer)
 	logrus.Info("cardano base local    : ", c.CardanoBaseLocal)
@@ -80,6 +123,15 @@ func (c *Config) LogConfig() {
 	logrus.Info("cardano host: ", c.CardanoHostAddress)
 	logrus.Info("cardano port: ", c.CardanoPort)
 	logrus.Info("cardano cmd: ", c.CardanoCmdStrings)
+	if c.IsProducer {
+		c.logProducerKeys()
+	}
+	if c.CardanoTracer.Enabled {
+		c.logCardanoTracer()
+	}
+	for _, m := range c.ExtraMounts {
+		logrus.Info("extra mount: ", m)
+	}
 	for key := range c.PortSet {
 		logrus.Info("exposed port: ", key)
 	}
@@ -94,14 +146,16 @@ func (c *Config) SetCardanoPaths() {
 	c.CardanoSocket = viper.GetString("cardano_socket")
 	c.CardanoHostAddress = viper.GetString("cardano_host_address")
 	c.CardanoPort = viper.GetString("cardano_port")
+}
 
+// SetCardanoBaseLocal creates cardano_base_local when it does not exist.
+func (c *Config) SetCardanoBaseLocal() {
 	if _, err := os.Stat(c.CardanoBaseLocal); os.IsNotExist(err) {
 		if err := os.MkdirAll(c.CardanoBaseLocal, os.ModePerm); err != nil {
 			err = errors.Annotatef(err,"creating dir path: %s", c.CardanoBaseLocal)
 			panic(err.Error())
 		}
 	}
-	c.CheckDockerContainerUp()
 }
 
 func (c *Config) SetContainerName() {
@@ -120,26 +174,25 @@ func (c *Config) SetMount() {
 			Target: c.CardanoBaseContainer,
 		},
 	}
+	if c.IsProducer {
+		c.Mounts = append(c.Mounts, c.producerKeyMounts()...)
+	}
+	c.Mounts = append(c.Mounts, c.extraMounts()...)
 }
 
 func (c *Config) SetExposedPorts() {
 	c.PortSet = make(map[nat.Port]struct{})
-	c.ExposedPorts = viper.GetStringSlice("expose_ports")
-	if !c.IsProducer {
-		cardanoPort := fmt.Sprintf("%s/tcp", c.CardanoPort)
-		c.ExposedPorts = append(c.ExposedPorts, cardanoPort)
-	}
+	c.ExposedPorts = portSpecs(viper.GetViper(), c.IsProducer)
 
 	c.PortMap = make(map[nat.Port][]nat.PortBinding)
 
-	for _, port := range c.ExposedPorts {
-		hostPort := strings.Split(port,"/")[0]
-		c.PortSet[nat.Port(port)] = struct{}{}
-		c.PortMap[nat.Port(port)] = []nat.PortBinding{
-            {
-                HostIP: "0.0.0.0",
-                HostPort: hostPort,
-            }}
+	mappings, err := parsePortSpecs(c.ExposedPorts)
+	if err != nil {
+		panic(errors.ErrorStack(err))
+	}
+	for _, m := range mappings {
+		c.PortSet[m.Port] = struct{}{}
+		c.PortMap[m.Port] = append(c.PortMap[m.Port], m.Binding)
 	}
 	logrus.Info("portBindings: ", c.PortMap)
 }
@@ -157,7 +210,7 @@ func (c *Config) SetCmdStrings() {
 	dataBasePathS := "--database-path"
 	dataBasePathC := fmt.Sprintf("%s%s", c.CardanoBaseContainer, c.CardanoDB)
 	socketPathS := "--socket-path"
-	socketPathC := fmt.Sprintf("%s%s", c.CardanoBaseContainer, c.CardanoSocket)
+	socketPathC := c.SocketPath()
 	portS := "--port"
 	portC :=  c.CardanoPort
 	hostAddrS := "--host-addr"
@@ -185,6 +238,19 @@ func (c *Config) SetCmdStrings() {
 
 		topologyS,
 		topologyC)
+
+	if c.IsProducer {
+		c.CardanoCmdStrings = append(c.CardanoCmdStrings, c.producerKeyArgs()...)
+	}
+	if c.CardanoTracer.Enabled {
+		c.CardanoCmdStrings = append(c.CardanoCmdStrings, c.tracerSocketArgs()...)
+	}
+	c.CardanoCmdStrings = append(c.CardanoCmdStrings, c.CardanoExtraArgs...)
+}
+
+// SocketPath is the path of the node socket in the container.
+func (c *Config) SocketPath() string {
+	return fmt.Sprintf("%s%s", c.CardanoBaseContainer, c.CardanoSocket)
 }
 
 func (c *Config) SetContainerConfig() {
@@ -194,6 +260,7 @@ func (c *Config) SetContainerConfig() {
 		Cmd:          c.CardanoCmdStrings,
 		Tty:          false,
 		ExposedPorts: c.PortSet,
+		Env:          c.ContainerEnv,
 	}
 }
 
@@ -0,0 +1,172 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/juju/errors"
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const defaultDownloadTimeout = 60 * time.Second
+const defaultDownloadRetries = 3
+
+// downloadError is a failed download attempt, retryable when another
+// attempt may succeed (network errors, 5xx, 408 and 429).
+type downloadError struct {
+	err       error
+	retryable bool
+}
+
+func (e *downloadError) Error() string {
+	return e.err.Error()
+}
+
+// downloadCacheDir returns cardano_download.cache_dir, by default
+// ~/.cache/gocard/downloads.
+func downloadCacheDir() string {
+	if dir := viper.GetString("cardano_download.cache_dir"); dir != "" {
+		return dir
+	}
+	home, err := homedir.Dir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "gocard-downloads")
+	}
+	return filepath.Join(home, ".cache", "gocard", "downloads")
+}
+
+// download fetches url into the download cache, retrying with exponential
+// backoff, then copies the cached file to target. A cached file is
+// revalidated with its ETag so unchanged files are not transferred again.
+func (s *httpSource) download(url, target string) error {
+	if err := os.MkdirAll(s.cacheDir, os.ModePerm); err != nil {
+		return errors.Annotatef(err, "creating dir: %s", s.cacheDir)
+	}
+	sum := sha256.Sum256([]byte(url))
+	cached := filepath.Join(s.cacheDir, hex.EncodeToString(sum[:8])+"-"+filepath.Base(url))
+
+	var err error
+	for attempt := 0; attempt <= s.retries; attempt++ {
+		if attempt > 0 {
+			wait := s.backoff * time.Duration(1<<uint(attempt-1))
+			logrus.Infof("retrying %s in %s", url, wait)
+			time.Sleep(wait)
+		}
+
+		err = s.downloadOnce(url, cached)
+		if err == nil {
+			break
+		}
+		if dErr, ok := err.(*downloadError); !ok || !dErr.retryable {
+			return err
+		}
+		logrus.Warnf("download attempt %d of %s failed: %s", attempt+1, url, err.Error())
+	}
+	if err != nil {
+		return err
+	}
+
+	in, err := os.Open(cached)
+	if err != nil {
+		return errors.Annotatef(err, "opening cached %s", cached)
+	}
+	defer in.Close()
+
+	logrus.Info("writing to: ", target)
+	return writeFile(in, target)
+}
+
+func (s *httpSource) downloadOnce(url, cached string) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	etagFile := cached + ".etag"
+	if etag, errE := ioutil.ReadFile(etagFile); errE == nil {
+		if _, errS := os.Stat(cached); errS == nil {
+			req.Header.Set("If-None-Match", string(etag))
+		}
+	}
+
+	logrus.Info("downloading file from: ", url)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return &downloadError{err: err, retryable: true}
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		logrus.Info("not modified, using cached: ", cached)
+		return nil
+	case resp.StatusCode == http.StatusOK:
+	case resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests ||
+		resp.StatusCode == http.StatusRequestTimeout:
+		return &downloadError{err: errors.Errorf("%s: %s", url, resp.Status), retryable: true}
+	default:
+		return &downloadError{err: errors.Errorf("%s: %s", url, resp.Status)}
+	}
+
+	if err = checkContentType(resp.Header.Get("Content-Type")); err != nil {
+		return &downloadError{err: errors.Annotate(err, url)}
+	}
+
+	if err = writeFile(resp.Body, cached); err != nil {
+		return &downloadError{err: errors.Annotatef(err, "downloading %s", url), retryable: true}
+	}
+	if err = checkJSONFile(cached); err != nil {
+		os.Remove(cached)
+		return &downloadError{err: errors.Annotate(err, url)}
+	}
+
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		if err = ioutil.WriteFile(etagFile, []byte(etag), 0644); err != nil {
+			logrus.Warn("could not cache etag: ", err.Error())
+		}
+	} else {
+		os.Remove(etagFile)
+	}
+	return nil
+}
+
+// checkContentType refuses HTML, which is what error pages and captive
+// portals serve with a 200 status.
+func checkContentType(contentType string) error {
+	if contentType == "" {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return errors.Annotatef(err, "parsing content type %s", contentType)
+	}
+	switch mediaType {
+	case "application/json", "text/plain", "application/octet-stream", "binary/octet-stream":
+		return nil
+	default:
+		return fmt.Errorf("unexpected content type %s", mediaType)
+	}
+}
+
+// checkJSONFile makes sure a downloaded configuration file is valid JSON,
+// all the cardano configuration files are.
+func checkJSONFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if !json.Valid(data) {
+		return errors.Errorf("downloaded file is not valid json")
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"os"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// EnvPrefix is prepended to every configuration key when it is looked up in
+// the environment, e.g. docker_image is read from GOCARD_DOCKER_IMAGE.
+const EnvPrefix = "GOCARD"
+
+var envKeyReplacer = strings.NewReplacer(".", "_")
+
+// BindEnv makes viper read GOCARD_ prefixed environment variables, mapping
+// nested keys such as cardano_hasprometheus.port to
+// GOCARD_CARDANO_HASPROMETHEUS_PORT.
+func BindEnv() {
+	viper.SetEnvPrefix(EnvPrefix)
+	viper.SetEnvKeyReplacer(envKeyReplacer)
+	viper.AutomaticEnv()
+}
+
+// EnvVarName returns the environment variable that overrides key.
+func EnvVarName(key string) string {
+	return EnvPrefix + "_" + strings.ToUpper(envKeyReplacer.Replace(key))
+}
+
+// envOverride reports whether key is currently overridden from the environment.
+func envOverride(key string) bool {
+	_, ok := os.LookupEnv(EnvVarName(key))
+	return ok
+}
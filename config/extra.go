@@ -0,0 +1,127 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/juju/errors"
+	"github.com/spf13/viper"
+)
+
+// ExtraMount is an additional bind mount declared in extra_mounts.
+type ExtraMount struct {
+	Source   string `mapstructure:"source"`
+	Target   string `mapstructure:"target"`
+	ReadOnly bool   `mapstructure:"read_only"`
+}
+
+// gocardFlags are the cardano-node flags gocard sets itself, they cannot be
+// given again in cardano_extra_args.
+var gocardFlags = []string{
+	"--database-path",
+	"--socket-path",
+	"--port",
+	"--host-addr",
+	"--config",
+	"--topology",
+	"--shelley-kes-key",
+	"--shelley-vrf-key",
+	"--shelley-operational-certificate",
+	"--tracer-socket-path-connect",
+}
+
+// SetExtras reads the additional node arguments, container environment and
+// mounts and checks they do not conflict with what gocard sets up.
+func (c *Config) SetExtras() {
+	c.CardanoExtraArgs = viper.GetStringSlice("cardano_extra_args")
+	c.ContainerEnv = viper.GetStringSlice("container_env")
+	c.ExtraMounts = nil
+	if err := viper.UnmarshalKey("extra_mounts", &c.ExtraMounts); err != nil {
+		panic(errors.Annotate(err, "reading extra_mounts").Error())
+	}
+
+	checks := []func() error{c.checkExtraArgs, c.checkContainerEnv, c.checkExtraMounts}
+	for _, check := range checks {
+		if err := check(); err != nil {
+			panic(errors.ErrorStack(err))
+		}
+	}
+}
+
+func (c *Config) checkExtraArgs() error {
+	for _, arg := range c.CardanoExtraArgs {
+		flag := strings.SplitN(arg, "=", 2)[0]
+		for _, gocardFlag := range gocardFlags {
+			if flag == gocardFlag {
+				return errors.Errorf("cardano_extra_args: %s is set by gocard and cannot be overridden", flag)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Config) checkContainerEnv() error {
+	names := make(map[string]struct{}, len(c.ContainerEnv))
+	for _, env := range c.ContainerEnv {
+		parts := strings.SplitN(env, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return errors.Errorf("container_env: %q is not in NAME=value form", env)
+		}
+		if _, ok := names[parts[0]]; ok {
+			return errors.Errorf("container_env: %s is set more than once", parts[0])
+		}
+		names[parts[0]] = struct{}{}
+	}
+	return nil
+}
+
+// checkExtraMounts refuses mounts that would replace or shadow the cardano
+// directory or the producer keys.
+func (c *Config) checkExtraMounts() error {
+	reserved := []string{c.CardanoBaseContainer, c.CardanoKeysContainer}
+	targets := make(map[string]struct{}, len(c.ExtraMounts))
+
+	for _, m := range c.ExtraMounts {
+		if !filepath.IsAbs(m.Source) || !path.IsAbs(m.Target) {
+			return errors.Errorf("extra_mounts: source %q and target %q must be absolute paths", m.Source, m.Target)
+		}
+
+		target := path.Clean(m.Target)
+		if _, ok := targets[target]; ok {
+			return errors.Errorf("extra_mounts: %s is mounted more than once", target)
+		}
+		targets[target] = struct{}{}
+
+		for _, dir := range reserved {
+			dir = path.Clean(dir)
+			if target == dir || strings.HasPrefix(target, dir+"/") || strings.HasPrefix(dir, target+"/") {
+				return errors.Errorf("extra_mounts: %s conflicts with %s managed by gocard", target, dir)
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Config) extraMounts() []mount.Mount {
+	mounts := make([]mount.Mount, 0, len(c.ExtraMounts))
+	for _, m := range c.ExtraMounts {
+		mounts = append(mounts, mount.Mount{
+			Type:     mount.TypeBind,
+			Source:   m.Source,
+			Target:   m.Target,
+			ReadOnly: m.ReadOnly,
+		})
+	}
+	return mounts
+}
+
+func (m ExtraMount) String() string {
+	mode := "rw"
+	if m.ReadOnly {
+		mode = "ro"
+	}
+	return fmt.Sprintf("%s:%s:%s", m.Source, m.Target, mode)
+}
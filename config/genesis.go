@@ -0,0 +1,262 @@
+package config
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/tidwall/gjson"
+	"golang.org/x/crypto/blake2b"
+)
+
+const GenesisByron = "Byron"
+const GenesisShelley = "Shelley"
+const GenesisAlonzo = "Alonzo"
+const GenesisConway = "Conway"
+
+const mainnetMagic = 764824073
+
+// GenesisHash computes the hash cardano-node expects in config.json for the
+// given genesis file. Shelley based genesis files are hashed as they are on
+// disk, the byron genesis is hashed over its canonical JSON rendering.
+func GenesisHash(era, filePath string) (string, error) {
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return "", errors.Annotatef(err, "reading genesis file %s", filePath)
+	}
+
+	if era == GenesisByron {
+		if data, err = canonicalJSON(data); err != nil {
+			return "", errors.Annotatef(err, "rendering canonical json for %s", filePath)
+		}
+	}
+
+	sum := blake2b.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// canonicalJSON renders a JSON document the way the byron ledger does before
+// hashing it: no whitespace, object keys sorted and only '"' and '\' escaped.
+func canonicalJSON(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	if err := writeCanonical(buf, value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeCanonical(buf *bytes.Buffer, value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		if v {
+			buf.WriteString("true")
+		} else {
+			buf.WriteString("false")
+		}
+	case json.Number:
+		if _, err := v.Int64(); err != nil {
+			return errors.Errorf("canonical json only supports integers, found: %s", v)
+		}
+		buf.WriteString(v.String())
+	case string:
+		buf.WriteByte('"')
+		for i := 0; i < len(v); i++ {
+			if v[i] == '"' || v[i] == '\\' {
+				buf.WriteByte('\\')
+			}
+			buf.WriteByte(v[i])
+		}
+		buf.WriteByte('"')
+	case []interface{}:
+		buf.WriteByte('[')
+		for i := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonical(buf, v[i]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		buf.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonical(buf, key); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := writeCanonical(buf, v[key]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return fmt.Errorf("unexpected json value of type %T", value)
+	}
+	return nil
+}
+
+// genesisEras orders the well known eras, any other era referenced by
+// config.json sorts after them.
+var genesisEras = []string{GenesisByron, GenesisShelley, GenesisAlonzo, GenesisConway}
+
+// genesisRef is a genesis file referenced by config.json through the
+// <Era>GenesisFile key, with the hash declared in <Era>GenesisHash.
+type genesisRef struct {
+	era  string
+	file string
+	hash string
+}
+
+// genesisRefs returns every genesis file referenced by a node configuration.
+func genesisRefs(nodeConfig *NodeConfig) []genesisRef {
+	eras := nodeConfig.GenesisEras()
+	refs := make([]genesisRef, 0, len(eras))
+	for _, era := range eras {
+		genesis := nodeConfig.Genesis[era]
+		refs = append(refs, genesisRef{era: era, file: genesis.File, hash: genesis.Hash})
+	}
+	return refs
+}
+
+func readGenesisRefs(configFile string) ([]genesisRef, error) {
+	nodeConfig, err := LoadNodeConfig(configFile)
+	if err != nil {
+		return nil, err
+	}
+	return genesisRefs(nodeConfig), nil
+}
+
+// VerifyGenesisHashes checks every genesis file referenced by config.json
+// against the hash declared next to it and reports each file that does not
+// match.
+func (c *Config) VerifyGenesisHashes() error {
+	configDir := fmt.Sprintf("%s/config", c.CardanoBaseLocal)
+	refs, err := readGenesisRefs(fmt.Sprintf("%s/%s", configDir, newConfig))
+	if err != nil {
+		return err
+	}
+
+	mismatches := make([]string, 0)
+	for _, ref := range refs {
+		if ref.hash == "" {
+			logrus.Infof("%s genesis %s: no hash declared in config.json, not verified", ref.era, ref.file)
+			continue
+		}
+
+		filePath := ref.file
+		if !filepath.IsAbs(filePath) {
+			filePath = filepath.Join(configDir, ref.file)
+		}
+		actual, err := GenesisHash(ref.era, filePath)
+		if err != nil {
+			return err
+		}
+
+		if actual != ref.hash {
+			mismatches = append(mismatches, fmt.Sprintf("%s genesis %s: config.json declares %s, file hashes to %s",
+				ref.era, filePath, ref.hash, actual))
+			continue
+		}
+		logrus.Infof("%s genesis %s: hash verified", ref.era, ref.file)
+	}
+
+	if len(mismatches) > 0 {
+		return errors.Errorf("genesis hash mismatch:\n  %s", strings.Join(mismatches, "\n  "))
+	}
+	return nil
+}
+
+// NetworkArgs are the cardano-cli arguments selecting the node's network.
+func (c *Config) NetworkArgs() ([]string, error) {
+	magic, err := c.networkMagic()
+	if err != nil {
+		return nil, err
+	}
+	if magic == mainnetMagic {
+		return []string{"--mainnet"}, nil
+	}
+	return []string{"--testnet-magic", strconv.FormatInt(magic, 10)}, nil
+}
+
+// ShelleyGenesis holds the shelley genesis parameters gocard works with.
+type ShelleyGenesis struct {
+	NetworkMagic      int64
+	SystemStart       time.Time
+	SlotLength        time.Duration
+	SlotsPerKESPeriod int64
+	MaxKESEvolutions  int64
+}
+
+// networkMagic reads the network magic from the shelley genesis referenced
+// by config.json.
+func (c *Config) networkMagic() (int64, error) {
+	genesis, err := c.ShelleyGenesis()
+	if err != nil {
+		return 0, err
+	}
+	return genesis.NetworkMagic, nil
+}
+
+// ShelleyGenesis reads the shelley genesis referenced by config.json.
+func (c *Config) ShelleyGenesis() (*ShelleyGenesis, error) {
+	configDir := fmt.Sprintf("%s/config", c.CardanoBaseLocal)
+	refs, err := readGenesisRefs(filepath.Join(configDir, newConfig))
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range refs {
+		if ref.era != GenesisShelley {
+			continue
+		}
+		filePath := ref.file
+		if !filepath.IsAbs(filePath) {
+			filePath = filepath.Join(configDir, ref.file)
+		}
+		data, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			return nil, errors.Annotatef(err, "reading shelley genesis %s", filePath)
+		}
+
+		genesis := &ShelleyGenesis{
+			NetworkMagic:      gjson.GetBytes(data, "networkMagic").Int(),
+			SlotLength:        time.Duration(gjson.GetBytes(data, "slotLength").Float() * float64(time.Second)),
+			SlotsPerKESPeriod: gjson.GetBytes(data, "slotsPerKESPeriod").Int(),
+			MaxKESEvolutions:  gjson.GetBytes(data, "maxKESEvolutions").Int(),
+		}
+		if start := gjson.GetBytes(data, "systemStart").String(); start != "" {
+			if genesis.SystemStart, err = time.Parse(time.RFC3339, start); err != nil {
+				return nil, errors.Annotatef(err, "shelley genesis %s systemStart", filePath)
+			}
+		}
+		return genesis, nil
+	}
+	return nil, errors.New("config.json references no shelley genesis, the network parameters are unknown")
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// The genesis files of the preview bundle are the published ones, the hashes
+// are the ByronGenesisHash and ShelleyGenesisHash of the published preview
+// config.json.
+const previewByronHash = "83de1d7302569ad56cf9139a41e2e11346d4cb4a31c00142557b6ab3fa550761"
+const previewShelleyHash = "363498d1024f84bb39d3fa9593ce391483cb40d479b87233f868d6e57c3a400d"
+
+func TestGenesisHash(t *testing.T) {
+	byron := filepath.Join("bundles", "preview", "byron-genesis.json")
+	shelley := filepath.Join("bundles", "preview", "shelley-genesis.json")
+
+	// reformatted copies: byron is hashed over canonical json so only the
+	// layout changing does not matter, shelley is hashed as it is on disk
+	dir := t.TempDir()
+	reformatted := func(name string) string {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := &bytes.Buffer{}
+		if err = json.Indent(out, data, "", "\t"); err != nil {
+			t.Fatal(err)
+		}
+		target := filepath.Join(dir, filepath.Base(name))
+		if err = ioutil.WriteFile(target, out.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return target
+	}
+
+	tests := []struct {
+		name     string
+		era      string
+		file     string
+		want     string
+		mismatch bool
+	}{
+		{"byron", GenesisByron, byron, previewByronHash, false},
+		{"shelley", GenesisShelley, shelley, previewShelleyHash, false},
+		{"reformatted byron", GenesisByron, reformatted(byron), previewByronHash, false},
+		{"reformatted shelley", GenesisShelley, reformatted(shelley), previewShelleyHash, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GenesisHash(tt.era, tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (got != tt.want) != tt.mismatch {
+				t.Errorf("got %s, published %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalJSON(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{`{ "b": 1, "a": [true, false, null] }`, `{"a":[true,false,null],"b":1}`, false},
+		{`{"s": "quote \" backslash \\ slash \/ unicode é"}`, `{"s":"quote \" backslash \\ slash / unicode é"}`, false},
+		{`{"big": 45000000000000000}`, `{"big":45000000000000000}`, false},
+		{`{"ratio": 0.5}`, ``, true},
+		{`{"a": 1`, ``, true},
+	}
+	for _, tt := range tests {
+		got, err := canonicalJSON([]byte(tt.in))
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %s", tt.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", tt.in, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
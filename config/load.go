@@ -0,0 +1,203 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/juju/errors"
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const LayerBase = "base"
+const LayerPidFile = "pid"
+
+// Layer is one of the files merged into the effective configuration.
+type Layer struct {
+	Name string
+	Path string
+}
+
+var layers []Layer
+
+// loadedFile and loadedProfiles remember the arguments of the last Load so
+// the configuration can be reloaded while a node is running.
+var loadedFile string
+var loadedProfiles []string
+
+// keyLayer records, for every key, the last layer that set it.
+var keyLayer = map[string]string{}
+
+// Load reads the base configuration file, then deep merges the overlay of
+// every profile in the order given and finally the pid file written by a
+// running node. Nested maps are merged key by key, any other value
+// (including lists) is replaced by the later layer. Environment variables
+// take precedence over all layers.
+//
+// The overlay for profile "prod" of /etc/cardano/gocard.yaml is
+// /etc/cardano/gocard.prod.yaml.
+//
+// References (file:, env:, secret:) are resolved, a reference that can not
+// be resolved is an error.
+func Load(cfgFile string, profiles []string) error {
+	if err := load(cfgFile, profiles); err != nil {
+		return err
+	}
+	if err := ResolveSecrets(); err != nil {
+		return err
+	}
+	ApplyLogLevel()
+	return nil
+}
+
+// LoadReferences reads the configuration like Load but keeps references as
+// written, for the commands that manage the secrets file or show the
+// configuration and must work while a reference is broken.
+func LoadReferences(cfgFile string, profiles []string) error {
+	secretKeys = map[string]struct{}{}
+	if err := load(cfgFile, profiles); err != nil {
+		return err
+	}
+	ApplyLogLevel()
+	return nil
+}
+
+func load(cfgFile string, profiles []string) error {
+	layers = nil
+	keyLayer = map[string]string{}
+	loadedFile = cfgFile
+	loadedProfiles = profiles
+
+	if err := setup(cfgFile); err != nil {
+		return err
+	}
+
+	// If a config file is found, read it in.
+	if err := viper.ReadInConfig(); err == nil {
+		logrus.Info("Using config file:", viper.ConfigFileUsed())
+		addLayer(LayerBase, viper.ConfigFileUsed())
+	} else if _, invalid := err.(viper.ConfigParseError); invalid {
+		return errors.Annotate(err, "reading config file")
+	} else if len(profiles) > 0 {
+		return errors.Annotate(err, "profiles require a base config file")
+	}
+
+	for _, profile := range profiles {
+		profilePath := ProfilePath(ConfigFileUsed(), profile)
+		if _, err := os.Stat(profilePath); err != nil {
+			return errors.Annotatef(err, "profile %s", profile)
+		}
+		logrus.Info("Merging profile config file:", profilePath)
+		if err := mergeLayer(profile, profilePath); err != nil {
+			return err
+		}
+	}
+
+	if _, err := os.Stat(GocardPidFile); err == nil {
+		logrus.Info("found docker ID")
+		if err := mergeLayer(LayerPidFile, GocardPidFile); err != nil {
+			return err
+		}
+		logrus.Info("docker ID : ", viper.GetString("container_id"))
+	}
+
+	return nil
+}
+
+// setup tells viper where the config file is and binds the environment.
+func setup(cfgFile string) error {
+	if cfgFile != "" {
+		// Use config file from the flag.
+		viper.SetConfigFile(cfgFile)
+	} else {
+		// Find home directory.
+		home, err := homedir.Dir()
+		if err != nil {
+			return errors.Annotate(err, "finding home directory")
+		}
+
+		// Search config in the cardano directories with name "gocard" (without extension).
+		viper.AddConfigPath(fmt.Sprintf("%s/cardano-node/config", home))
+		viper.AddConfigPath("./")
+		viper.AddConfigPath("/etc/cardano")
+		viper.SetConfigName("gocard")
+	}
+
+	BindEnv() // read in GOCARD_ prefixed environment variables
+	return nil
+}
+
+// Reload discards the current configuration and loads it again from the
+// same files, profiles and environment.
+// On failure the layers of the previous load are kept.
+func Reload() error {
+	previousLayers, previousKeyLayer := layers, keyLayer
+	viper.Reset()
+	if err := Load(loadedFile, loadedProfiles); err != nil {
+		layers, keyLayer = previousLayers, previousKeyLayer
+		return err
+	}
+	return nil
+}
+
+// ApplyLogLevel sets the logrus level from log_level, when present.
+func ApplyLogLevel() {
+	levelName := viper.GetString("log_level")
+	if levelName == "" {
+		return
+	}
+	level, err := logrus.ParseLevel(levelName)
+	if err != nil {
+		logrus.Warnf("invalid log_level %s: %s", levelName, err.Error())
+		return
+	}
+	logrus.SetLevel(level)
+}
+
+// ProfilePath returns the overlay file of profile next to the base file.
+func ProfilePath(base, profile string) string {
+	ext := filepath.Ext(base)
+	return fmt.Sprintf("%s.%s%s", strings.TrimSuffix(base, ext), profile, ext)
+}
+
+// ConfigFileUsed returns the base config file, viper.ConfigFileUsed reports
+// the last merged layer instead.
+func ConfigFileUsed() string {
+	for i := range layers {
+		if layers[i].Name == LayerBase {
+			return layers[i].Path
+		}
+	}
+	return ""
+}
+
+// Layers returns the merged configuration files, lowest precedence first.
+func Layers() []Layer {
+	return layers
+}
+
+func mergeLayer(name, path string) error {
+	viper.SetConfigFile(path)
+	if err := viper.MergeInConfig(); err != nil {
+		return errors.Annotatef(err, "merging viper config %s", path)
+	}
+	addLayer(name, path)
+	return nil
+}
+
+func addLayer(name, path string) {
+	layers = append(layers, Layer{Name: name, Path: path})
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		logrus.Warnf("could not read %s to track key sources: %s", path, err.Error())
+		return
+	}
+	for _, key := range v.AllKeys() {
+		keyLayer[key] = name
+	}
+}
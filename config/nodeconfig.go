@@ -0,0 +1,473 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+const ScribeKindFile = "FileSK"
+const ScribeKindStdout = "StdoutSK"
+const ScribeFormatText = "ScText"
+const ScribeFormatJSON = "ScJson"
+
+// NodeConfig is a cardano-node config.json. The settings gocard edits are
+// typed, every other key is kept as it was read so a load and save round
+// trip only changes what was changed on purpose.
+type NodeConfig struct {
+	Protocol             string
+	RequiresNetworkMagic string
+	MinSeverity          string
+	TurnOnLogging        *bool
+	TurnOnLogMetrics     *bool
+	DefaultBackends      []string
+	SetupBackends        []string
+	DefaultScribes       []ScribeRef
+	SetupScribes         []Scribe
+	Rotation             *Rotation
+	HasPrometheus        *Endpoint
+	HasEKG               *EKG
+	UseTraceDispatcher   *bool
+	EnableP2P            *bool
+	TraceOptionNodeName  string
+	// TraceOptions configures the new tracing system, keyed by namespace.
+	TraceOptions map[string]TraceOption
+	// Tracers holds the boolean Trace* switches.
+	Tracers map[string]bool
+	// Genesis is keyed by era, from the <Era>GenesisFile and <Era>GenesisHash keys.
+	Genesis map[string]GenesisFile
+
+	extra map[string]json.RawMessage
+}
+
+// GenesisFile is the genesis file of an era and its declared hash.
+type GenesisFile struct {
+	File string
+	Hash string
+}
+
+// ScribeRef is a [kind, name] entry of defaultScribes.
+type ScribeRef [2]string
+
+func (sr ScribeRef) Kind() string {
+	return sr[0]
+}
+
+func (sr ScribeRef) Name() string {
+	return sr[1]
+}
+
+// Scribe is an entry of setupScribes.
+type Scribe struct {
+	ScFormat   string    `json:"scFormat"`
+	ScKind     string    `json:"scKind"`
+	ScName     string    `json:"scName"`
+	ScRotation *Rotation `json:"scRotation"`
+	ScPrivacy  string    `json:"scPrivacy,omitempty"`
+	ScMinSev   string    `json:"scMinSev,omitempty"`
+	ScMaxSev   string    `json:"scMaxSev,omitempty"`
+}
+
+// Rotation is the log rotation policy of the node or of a scribe.
+type Rotation struct {
+	RpLogLimitBytes int64 `json:"rpLogLimitBytes"`
+	RpKeepFilesNum  int   `json:"rpKeepFilesNum"`
+	RpMaxAgeHours   int   `json:"rpMaxAgeHours"`
+}
+
+// TraceOption is the configuration of a namespace of the new tracing system.
+type TraceOption struct {
+	Severity     string   `json:"severity,omitempty"`
+	Detail       string   `json:"detail,omitempty"`
+	Backends     []string `json:"backends,omitempty"`
+	MaxFrequency *float64 `json:"maxFrequency,omitempty"`
+}
+
+// Endpoint is a ["host", port] pair, as used by hasPrometheus.
+type Endpoint struct {
+	Host string
+	Port int
+}
+
+func (e Endpoint) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{e.Host, e.Port})
+}
+
+func (e *Endpoint) UnmarshalJSON(data []byte) error {
+	var pair []json.RawMessage
+	if err := json.Unmarshal(data, &pair); err != nil || len(pair) != 2 {
+		return errors.Errorf("expected [\"host\", port], found %s", data)
+	}
+	if err := json.Unmarshal(pair[0], &e.Host); err != nil {
+		return errors.Annotate(err, "endpoint host")
+	}
+	return errors.Annotate(json.Unmarshal(pair[1], &e.Port), "endpoint port")
+}
+
+// EKG is hasEKG, either a port or a ["host", port] pair.
+type EKG struct {
+	Endpoint
+}
+
+func (e EKG) MarshalJSON() ([]byte, error) {
+	if e.Host == "" {
+		return json.Marshal(e.Port)
+	}
+	return e.Endpoint.MarshalJSON()
+}
+
+func (e *EKG) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &e.Port); err == nil {
+		e.Host = ""
+		return nil
+	}
+	return e.Endpoint.UnmarshalJSON(data)
+}
+
+// nodeConfigFields binds the typed config.json keys to their fields.
+func (n *NodeConfig) nodeConfigFields() map[string]interface{} {
+	return map[string]interface{}{
+		"Protocol":             &n.Protocol,
+		"RequiresNetworkMagic": &n.RequiresNetworkMagic,
+		"minSeverity":          &n.MinSeverity,
+		"TurnOnLogging":        &n.TurnOnLogging,
+		"TurnOnLogMetrics":     &n.TurnOnLogMetrics,
+		"defaultBackends":      &n.DefaultBackends,
+		"setupBackends":        &n.SetupBackends,
+		"defaultScribes":       &n.DefaultScribes,
+		"setupScribes":         &n.SetupScribes,
+		"rotation":             &n.Rotation,
+		"hasPrometheus":        &n.HasPrometheus,
+		"hasEKG":               &n.HasEKG,
+		"UseTraceDispatcher":   &n.UseTraceDispatcher,
+		"EnableP2P":            &n.EnableP2P,
+		"TraceOptionNodeName":  &n.TraceOptionNodeName,
+		"TraceOptions":         &n.TraceOptions,
+	}
+}
+
+// ParseNodeConfig parses a config.json document.
+func ParseNodeConfig(data []byte) (*NodeConfig, error) {
+	n := &NodeConfig{
+		Tracers: map[string]bool{},
+		Genesis: map[string]GenesisFile{},
+		extra:   map[string]json.RawMessage{},
+	}
+	if err := json.Unmarshal(data, &n.extra); err != nil {
+		return nil, errors.Annotate(err, "parsing node config")
+	}
+
+	for key, field := range n.nodeConfigFields() {
+		raw, ok := n.extra[key]
+		if !ok {
+			continue
+		}
+		if err := json.Unmarshal(raw, field); err != nil {
+			return nil, errors.Annotatef(err, "node config %s", key)
+		}
+		delete(n.extra, key)
+	}
+
+	for key, raw := range n.extra {
+		switch {
+		case strings.HasPrefix(key, "Trace"):
+			var enabled bool
+			if json.Unmarshal(raw, &enabled) == nil {
+				n.Tracers[key] = enabled
+				delete(n.extra, key)
+			}
+		case strings.HasSuffix(key, "GenesisFile"):
+			era := strings.TrimSuffix(key, "GenesisFile")
+			genesis := n.Genesis[era]
+			if err := json.Unmarshal(raw, &genesis.File); err != nil {
+				return nil, errors.Annotatef(err, "node config %s", key)
+			}
+			n.Genesis[era] = genesis
+			delete(n.extra, key)
+		case strings.HasSuffix(key, "GenesisHash"):
+			era := strings.TrimSuffix(key, "GenesisHash")
+			genesis := n.Genesis[era]
+			if err := json.Unmarshal(raw, &genesis.Hash); err != nil {
+				return nil, errors.Annotatef(err, "node config %s", key)
+			}
+			n.Genesis[era] = genesis
+			delete(n.extra, key)
+		}
+	}
+
+	return n, nil
+}
+
+// LoadNodeConfig reads a config.json file.
+func LoadNodeConfig(path string) (*NodeConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Annotatef(err, "reading %s", path)
+	}
+	n, err := ParseNodeConfig(data)
+	return n, errors.Annotate(err, path)
+}
+
+// MarshalJSON renders the configuration with sorted keys. Typed settings
+// that are unset are left out, as they were absent when read.
+func (n *NodeConfig) MarshalJSON() ([]byte, error) {
+	out := make(map[string]interface{}, len(n.extra)+len(n.Tracers)+16)
+	for key, raw := range n.extra {
+		out[key] = raw
+	}
+
+	for key, field := range n.nodeConfigFields() {
+		if !isUnset(field) {
+			out[key] = field
+		}
+	}
+	for key, enabled := range n.Tracers {
+		out[key] = enabled
+	}
+	for era, genesis := range n.Genesis {
+		if genesis.File != "" {
+			out[era+"GenesisFile"] = genesis.File
+		}
+		if genesis.Hash != "" {
+			out[era+"GenesisHash"] = genesis.Hash
+		}
+	}
+	return json.Marshal(out)
+}
+
+func isUnset(field interface{}) bool {
+	switch v := field.(type) {
+	case *string:
+		return *v == ""
+	case **bool:
+		return *v == nil
+	case *[]string:
+		return *v == nil
+	case *[]ScribeRef:
+		return *v == nil
+	case *[]Scribe:
+		return *v == nil
+	case **Rotation:
+		return *v == nil
+	case **Endpoint:
+		return *v == nil
+	case **EKG:
+		return *v == nil
+	case *map[string]TraceOption:
+		return *v == nil
+	default:
+		return false
+	}
+}
+
+// Save writes the configuration to path, indented, replacing it atomically.
+func (n *NodeConfig) Save(path string) error {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return errors.Annotate(err, "encoding node config")
+	}
+	buf := &bytes.Buffer{}
+	if err = json.Indent(buf, data, "", "  "); err != nil {
+		return errors.Annotate(err, "indenting node config")
+	}
+	buf.WriteByte('\n')
+	return errors.Annotatef(writeFile(buf, path), "writing %s", path)
+}
+
+// Get returns the JSON value at a dotted path, e.g. "hasPrometheus" or
+// "options.mapBackends".
+func (n *NodeConfig) Get(path string) (json.RawMessage, error) {
+	doc, err := n.document()
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{} = doc
+	for _, part := range strings.Split(path, ".") {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, errors.Errorf("%s: not an object at %s", path, part)
+		}
+		if value, ok = m[part]; !ok {
+			return nil, errors.NotFoundf("%s", path)
+		}
+	}
+	return json.MarshalIndent(value, "", "  ")
+}
+
+// Set replaces the JSON value at a dotted path. The result must still parse
+// as a node configuration, so e.g. hasPrometheus cannot be set to a string.
+func (n *NodeConfig) Set(path string, value json.RawMessage) error {
+	var decoded interface{}
+	if err := json.Unmarshal(value, &decoded); err != nil {
+		return errors.Annotatef(err, "parsing value for %s", path)
+	}
+
+	doc, err := n.document()
+	if err != nil {
+		return err
+	}
+
+	parts := strings.Split(path, ".")
+	parent := doc
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := parent[part].(map[string]interface{})
+		if !ok {
+			if _, exists := parent[part]; exists {
+				return errors.Errorf("%s: %s is not an object", path, part)
+			}
+			child = map[string]interface{}{}
+			parent[part] = child
+		}
+		parent = child
+	}
+	parent[parts[len(parts)-1]] = decoded
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return errors.Annotate(err, "encoding node config")
+	}
+	updated, err := ParseNodeConfig(data)
+	if err != nil {
+		return errors.Annotatef(err, "setting %s", path)
+	}
+	*n = *updated
+	return nil
+}
+
+func (n *NodeConfig) document() (map[string]interface{}, error) {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return nil, errors.Annotate(err, "encoding node config")
+	}
+	doc := map[string]interface{}{}
+	return doc, errors.Annotate(json.Unmarshal(data, &doc), "decoding node config")
+}
+
+// HasScribe reports whether a default scribe of kind is configured.
+func (n *NodeConfig) HasScribe(kind string) bool {
+	for _, ref := range n.DefaultScribes {
+		if ref.Kind() == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// SetFileScribe makes sure a file scribe writing to logPath is both a default
+// scribe and set up. An existing file scribe keeps its format and rotation, a
+// new one logs text and follows the global rotation.
+func (n *NodeConfig) SetFileScribe(logPath string) *Scribe {
+	found := false
+	for i := range n.DefaultScribes {
+		if n.DefaultScribes[i].Kind() == ScribeKindFile {
+			n.DefaultScribes[i] = ScribeRef{ScribeKindFile, logPath}
+			found = true
+		}
+	}
+	if !found {
+		n.DefaultScribes = append(n.DefaultScribes, ScribeRef{ScribeKindFile, logPath})
+	}
+
+	for i := range n.SetupScribes {
+		if n.SetupScribes[i].ScKind == ScribeKindFile {
+			n.SetupScribes[i].ScName = logPath
+			return &n.SetupScribes[i]
+		}
+	}
+	n.SetupScribes = append(n.SetupScribes, Scribe{
+		ScFormat: ScribeFormatText,
+		ScKind:   ScribeKindFile,
+		ScName:   logPath,
+	})
+	return &n.SetupScribes[len(n.SetupScribes)-1]
+}
+
+// GenesisEras returns the eras with a genesis file, well known eras first.
+func (n *NodeConfig) GenesisEras() []string {
+	eras := make([]string, 0, len(n.Genesis))
+	for era, genesis := range n.Genesis {
+		if genesis.File != "" {
+			eras = append(eras, era)
+		}
+	}
+	order := func(era string) int {
+		for i := range genesisEras {
+			if genesisEras[i] == era {
+				return i
+			}
+		}
+		return len(genesisEras)
+	}
+	sort.SliceStable(eras, func(i, j int) bool {
+		if order(eras[i]) != order(eras[j]) {
+			return order(eras[i]) < order(eras[j])
+		}
+		return eras[i] < eras[j]
+	})
+	return eras
+}
+
+// String renders the configuration indented, for display.
+func (n *NodeConfig) String() string {
+	data, err := json.MarshalIndent(n, "", "  ")
+	if err != nil {
+		return fmt.Sprintf("invalid node config: %s", err.Error())
+	}
+	return string(data)
+}
+
+// NodeConfigFile is the path of the local config.json.
+func (c *Config) NodeConfigFile() string {
+	return fmt.Sprintf("%s/config/%s", c.CardanoBaseLocal, newConfig)
+}
+
+// IsManagedConfigKey reports whether the top level key of path is rewritten
+// by gocard on init and reload, the tracers of the preset included.
+func (c *Config) IsManagedConfigKey(path string, nodeConfig *NodeConfig) bool {
+	key := strings.SplitN(path, ".", 2)[0]
+	for _, managed := range c.managedConfigKeys(nodeConfig) {
+		if managed == key {
+			return true
+		}
+	}
+	return false
+}
+
+// managedConfigKeys returns the config.json keys gocard rewrites in
+// nodeConfig: the fixed ones, the new tracing system settings when
+// cardano-tracer is enabled, EnableP2P when the topology is generated and
+// the tracers it sets.
+func (c *Config) managedConfigKeys(nodeConfig *NodeConfig) []string {
+	keys := ManagedConfigKeys()
+	if c.CardanoTracer.Enabled {
+		keys = append(keys, "UseTraceDispatcher", "TraceOptionNodeName", "TraceOptions")
+	}
+	if layout, err := PoolLayout(); err == nil && layout != nil {
+		keys = append(keys, "EnableP2P")
+	}
+	settings, err := c.TracerSettings(nodeConfig.Tracers)
+	if err != nil {
+		// an invalid preset is reported when the settings are applied
+		return keys
+	}
+	for name := range settings {
+		keys = append(keys, name)
+	}
+	return keys
+}
+
+// ParseValue reads a command line value as JSON, falling back to a plain
+// string, so both 12798 and ScJson are accepted.
+func ParseValue(value string) json.RawMessage {
+	if json.Valid([]byte(value)) {
+		return json.RawMessage(value)
+	}
+	quoted, _ := json.Marshal(value)
+	return quoted
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const LogFormatText = "text"
+const LogFormatJSON = "json"
+
+// default rotation of the node log file, as in the published configurations
+const defaultLogLimitBytes = 5000000
+const defaultLogKeepFiles = 10
+const defaultLogMaxAgeHours = 24
+
+// logFormats maps the cardano_log.format values to scribe formats.
+var logFormats = map[string]string{
+	LogFormatText: ScribeFormatText,
+	LogFormatJSON: ScribeFormatJSON,
+}
+
+// logScribeFormat returns the scribe format selected with cardano_log.format.
+func logScribeFormat() (string, error) {
+	format := viper.GetString("cardano_log.format")
+	if format == "" {
+		format = LogFormatText
+	}
+	scFormat, ok := logFormats[format]
+	if !ok {
+		return "", errors.Errorf("cardano_log.format must be %s or %s, found: %s", LogFormatText, LogFormatJSON, format)
+	}
+	return scFormat, nil
+}
+
+// logRotation returns the rotation set with cardano_log.rotation, nil when
+// rotation is disabled.
+func logRotation() (*Rotation, error) {
+	if viper.IsSet("cardano_log.rotation.enabled") && !viper.GetBool("cardano_log.rotation.enabled") {
+		return nil, nil
+	}
+
+	rotation := &Rotation{
+		RpLogLimitBytes: defaultLogLimitBytes,
+		RpKeepFilesNum:  defaultLogKeepFiles,
+		RpMaxAgeHours:   defaultLogMaxAgeHours,
+	}
+	if viper.IsSet("cardano_log.rotation.limit_bytes") {
+		rotation.RpLogLimitBytes = viper.GetInt64("cardano_log.rotation.limit_bytes")
+	}
+	if viper.IsSet("cardano_log.rotation.keep_files") {
+		rotation.RpKeepFilesNum = viper.GetInt("cardano_log.rotation.keep_files")
+	}
+	if viper.IsSet("cardano_log.rotation.max_age_hours") {
+		rotation.RpMaxAgeHours = viper.GetInt("cardano_log.rotation.max_age_hours")
+	}
+
+	if rotation.RpLogLimitBytes <= 0 || rotation.RpKeepFilesNum <= 0 || rotation.RpMaxAgeHours <= 0 {
+		return nil, errors.Errorf("cardano_log.rotation values must be positive, found: %+v", *rotation)
+	}
+	return rotation, nil
+}
+
+// applyLogSettings writes the format and rotation of the node log file to
+// its scribe, and the rotation to the rotation section of the node
+// configuration.
+func applyLogSettings(nodeConfig *NodeConfig, scribe *Scribe) error {
+	scFormat, err := logScribeFormat()
+	if err != nil {
+		return err
+	}
+	rotation, err := logRotation()
+	if err != nil {
+		return err
+	}
+
+	scribe.ScFormat = scFormat
+	scribe.ScRotation = rotation
+	nodeConfig.Rotation = rotation
+
+	if rotation == nil {
+		logrus.Infof("node log %s: format %s, not rotated", scribe.ScName, scFormat)
+		return nil
+	}
+	logrus.Infof("node log %s: format %s, rotated at %d bytes, %d files kept for %d hours",
+		scribe.ScName, scFormat, rotation.RpLogLimitBytes, rotation.RpKeepFilesNum, rotation.RpMaxAgeHours)
+	return nil
+}
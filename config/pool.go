@@ -0,0 +1,38 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const defaultPoolKeysDirName = "pool-keys"
+
+// Pool holds the settings of the pool key workflows.
+type Pool struct {
+	// KeysDir is where the pool's key set is generated and kept.
+	KeysDir string
+	// CliEra is the era command cardano-cli key and certificate commands are
+	// run under, e.g. latest or conway. Older cardano-cli versions take none.
+	CliEra string
+}
+
+func (c *Config) SetPool() {
+	c.Pool = Pool{
+		KeysDir: viper.GetString("pool.keys_dir"),
+		CliEra:  viper.GetString("pool.cli_era"),
+	}
+	if c.Pool.KeysDir == "" {
+		c.Pool.KeysDir = filepath.Join(filepath.Dir(ConfigFileUsed()), defaultPoolKeysDirName)
+	}
+	if abs, err := filepath.Abs(c.Pool.KeysDir); err == nil {
+		c.Pool.KeysDir = abs
+	}
+
+	base, err := filepath.Abs(c.CardanoBaseLocal)
+	if err == nil && strings.HasPrefix(c.Pool.KeysDir+string(filepath.Separator), base+string(filepath.Separator)) {
+		logrus.Warnf("pool.keys_dir %s is inside cardano_base_local, the node container can read the cold keys", c.Pool.KeysDir)
+	}
+}
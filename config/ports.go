@@ -0,0 +1,248 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+	"github.com/juju/errors"
+	"github.com/spf13/viper"
+)
+
+const defaultHostIP = "0.0.0.0"
+
+// portSpecs returns the expose_ports entries of v plus, for relays, the
+// cardano port mapping. Entries use the docker syntax:
+//
+//   12798/tcp                    host port equal to the container port
+//   127.0.0.1:12798:12798/tcp    bound to one address
+//   [::]:3001:3001               bound to an IPv6 address
+//   3002:3001                    host port 3002 to container port 3001
+func portSpecs(v *viper.Viper, isProducer bool) []string {
+	specs := append([]string{}, v.GetStringSlice("expose_ports")...)
+	if !isProducer && v.GetString("cardano_port") != "" {
+		specs = append(specs, cardanoPortSpec(v))
+	}
+	return specs
+}
+
+// cardanoPortSpec maps cardano_host_ip:cardano_host_port on the host to the
+// cardano port of the container, cardano_host_port defaults to cardano_port.
+func cardanoPortSpec(v *viper.Viper) string {
+	port := v.GetString("cardano_port")
+	hostPort := v.GetString("cardano_host_port")
+	if hostPort == "" {
+		hostPort = port
+	}
+	if hostIP := v.GetString("cardano_host_ip"); hostIP != "" {
+		return fmt.Sprintf("%s:%s/tcp", net.JoinHostPort(hostIP, hostPort), port)
+	}
+	return fmt.Sprintf("%s:%s/tcp", hostPort, port)
+}
+
+// parsePortSpecs parses port entries, defaulting the host port to the
+// container port and the host address to 0.0.0.0.
+func parsePortSpecs(specs []string) ([]nat.PortMapping, error) {
+	mappings := make([]nat.PortMapping, 0, len(specs))
+	for _, spec := range specs {
+		parsed, err := nat.ParsePortSpec(spec)
+		if err != nil {
+			return nil, errors.Annotatef(err, "parsing port %s", spec)
+		}
+		for i := range parsed {
+			if parsed[i].Binding.HostPort == "" {
+				parsed[i].Binding.HostPort = parsed[i].Port.Port()
+			}
+			if parsed[i].Binding.HostIP == "" {
+				parsed[i].Binding.HostIP = defaultHostIP
+			}
+		}
+		mappings = append(mappings, parsed...)
+	}
+	return mappings, nil
+}
+
+// CheckPortCollisions makes sure no two port mappings of this node, RTView's
+// included, bind the same host port and address, that none of them collides
+// with another node configured on this host and that none of them is already
+// published by another running container. Every profile next to the base
+// config file that is not in use is taken to be such a node, running or not.
+// The node and cardano-tracer containers of this node are left out, they are
+// replaced when it starts.
+func (c *Config) CheckPortCollisions() error {
+	specs := append(append([]string{}, c.ExposedPorts...), c.CardanoTracer.portSpecs()...)
+	own, err := parsePortSpecs(specs)
+	if err != nil {
+		return err
+	}
+	for i := range own {
+		for j := i + 1; j < len(own); j++ {
+			if portsCollide(own[i], own[j]) {
+				return errors.Errorf("port %s and %s bind the same host port",
+					describeMapping(own[i]), describeMapping(own[j]))
+			}
+		}
+	}
+
+	profiles, err := otherNodePorts()
+	if err != nil {
+		return err
+	}
+	for name, mappings := range profiles {
+		for i := range own {
+			for j := range mappings {
+				if portsCollide(own[i], mappings[j]) {
+					return errors.Errorf("port %s collides with %s of profile %s",
+						describeMapping(own[i]), describeMapping(mappings[j]), name)
+				}
+			}
+		}
+	}
+
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return errors.Annotate(err, "creating docker client")
+	}
+	defer cli.Close()
+	containers, err := cli.ContainerList(context.Background(), types.ContainerListOptions{})
+	if err != nil {
+		return errors.Annotate(err, "listing running containers")
+	}
+
+	// the node container is created unnamed, only the tracer is found by name
+	others := publishedPorts(containers, c.ContainerID, c.CardanoTracer.ContainerName)
+	for name, mappings := range others {
+		for i := range own {
+			for j := range mappings {
+				if portsCollide(own[i], mappings[j]) {
+					return errors.Errorf("port %s collides with %s of container %s",
+						describeMapping(own[i]), describeMapping(mappings[j]), name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// otherNodePorts returns the port mappings of every profile not in use, by
+// profile name.
+func otherNodePorts() (map[string][]nat.PortMapping, error) {
+	base := ConfigFileUsed()
+	if base == "" {
+		return nil, nil
+	}
+
+	active := map[string]struct{}{}
+	for _, profile := range loadedProfiles {
+		active[profile] = struct{}{}
+	}
+
+	ext := filepath.Ext(base)
+	pattern := strings.TrimSuffix(base, ext) + ".*" + ext
+	overlays, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, errors.Annotatef(err, "listing profiles %s", pattern)
+	}
+
+	others := map[string][]nat.PortMapping{}
+	for _, overlay := range overlays {
+		profile := strings.TrimSuffix(strings.TrimPrefix(overlay, strings.TrimSuffix(base, ext)+"."), ext)
+		if _, ok := active[profile]; ok || strings.Contains(profile, ".") {
+			continue
+		}
+
+		v := viper.New()
+		v.SetConfigFile(base)
+		if err := v.ReadInConfig(); err != nil {
+			return nil, errors.Annotatef(err, "reading %s", base)
+		}
+		v.SetConfigFile(overlay)
+		if err := v.MergeInConfig(); err != nil {
+			return nil, errors.Annotatef(err, "reading %s", overlay)
+		}
+
+		mappings, err := parsePortSpecs(portSpecs(v, v.GetBool("service_is_producer")))
+		if err != nil {
+			return nil, errors.Annotatef(err, "profile %s", profile)
+		}
+		others[profile] = mappings
+	}
+	return others, nil
+}
+
+// publishedPorts returns the host ports published by containers, by
+// container name, leaving out the container with ID ownID and the ones
+// named ownNames.
+func publishedPorts(containers []types.Container, ownID string, ownNames ...string) map[string][]nat.PortMapping {
+	skip := map[string]struct{}{}
+	for _, name := range ownNames {
+		if name != "" {
+			skip[name] = struct{}{}
+		}
+	}
+
+	others := map[string][]nat.PortMapping{}
+	for _, container := range containers {
+		if ownID != "" && container.ID == ownID {
+			continue
+		}
+		name := container.ID
+		if len(container.Names) > 0 {
+			name = strings.TrimPrefix(container.Names[0], "/")
+		}
+		if _, ok := skip[name]; ok {
+			continue
+		}
+
+		for _, p := range container.Ports {
+			if p.PublicPort == 0 {
+				continue
+			}
+			port, err := nat.NewPort(p.Type, strconv.Itoa(int(p.PrivatePort)))
+			if err != nil {
+				continue
+			}
+			hostIP := p.IP
+			if hostIP == "" {
+				hostIP = defaultHostIP
+			}
+			others[name] = append(others[name], nat.PortMapping{
+				Port:    port,
+				Binding: nat.PortBinding{HostIP: hostIP, HostPort: strconv.Itoa(int(p.PublicPort))},
+			})
+		}
+	}
+	return others
+}
+
+func portsCollide(a, b nat.PortMapping) bool {
+	if a.Port.Proto() != b.Port.Proto() || a.Binding.HostPort != b.Binding.HostPort {
+		return false
+	}
+	return addressesOverlap(a.Binding.HostIP, b.Binding.HostIP)
+}
+
+// addressesOverlap reports whether binding both addresses on the same port
+// would conflict: they are equal or one is the unspecified address of the
+// other's family.
+func addressesOverlap(a, b string) bool {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	if ipA == nil || ipB == nil {
+		return a == b
+	}
+	if ipA.Equal(ipB) {
+		return true
+	}
+	sameFamily := (ipA.To4() == nil) == (ipB.To4() == nil)
+	return sameFamily && (ipA.IsUnspecified() || ipB.IsUnspecified())
+}
+
+func describeMapping(m nat.PortMapping) string {
+	return fmt.Sprintf("%s->%s", net.JoinHostPort(m.Binding.HostIP, m.Binding.HostPort), m.Port)
+}
@@ -0,0 +1,234 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"github.com/tidwall/gjson"
+)
+
+const NetworkMainnet = "mainnet"
+const NetworkPreview = "preview"
+const NetworkPrivate = "private"
+
+const privateByronGenesis = "byron-genesis.json"
+const privateShelleyGenesis = "shelley-genesis.json"
+const privateAlonzoGenesis = "alonzo-genesis.json"
+const privateConwayGenesis = "conway-genesis.json"
+
+// privateConfigTemplate is the config.json used for private networks when no
+// config_template is given in gocard.yaml. Genesis files and hashes are
+// filled in by gocard, logging and prometheus by updateCardanoConfig.
+const privateConfigTemplate = `{
+  "Protocol": "Cardano",
+  "RequiresNetworkMagic": "RequiresMagic",
+  "LastKnownBlockVersion-Major": 3,
+  "LastKnownBlockVersion-Minor": 0,
+  "LastKnownBlockVersion-Alt": 0,
+  "MaxKnownMajorProtocolVersion": 2,
+  "TestShelleyHardForkAtEpoch": 0,
+  "TestAllegraHardForkAtEpoch": 0,
+  "TestMaryHardForkAtEpoch": 0,
+  "TestAlonzoHardForkAtEpoch": 0,
+  "TestBabbageHardForkAtEpoch": 0,
+  "TurnOnLogging": true,
+  "TurnOnLogMetrics": true,
+  "minSeverity": "Info",
+  "defaultBackends": [
+    "KatipBK"
+  ],
+  "defaultScribes": [
+    [
+      "StdoutSK",
+      "stdout"
+    ]
+  ],
+  "setupBackends": [
+    "KatipBK"
+  ],
+  "setupScribes": [
+    {
+      "scFormat": "ScText",
+      "scKind": "StdoutSK",
+      "scName": "stdout",
+      "scRotation": null
+    }
+  ]
+}`
+
+const privateEmptyTopology = `{
+  "Producers": []
+}`
+
+type PrivateNetwork struct {
+	NetworkMagic   int64
+	ByronGenesis   string
+	ShelleyGenesis string
+	AlonzoGenesis  string
+	ConwayGenesis  string
+	ConfigTemplate string
+	Topology       string
+}
+
+type privateGenesis struct {
+	era      string
+	source   string
+	fileName string
+}
+
+func (c *Config) SetPrivateNetwork() {
+	c.CardanoNetwork = viper.GetString("cardano_network")
+	if c.CardanoNetwork == "" {
+		c.CardanoNetwork = NetworkMainnet
+	}
+
+	if !c.IsPrivateNetwork() {
+		return
+	}
+
+	c.PrivateNetwork = PrivateNetwork{
+		NetworkMagic:   viper.GetInt64("cardano_private_network.network_magic"),
+		ByronGenesis:   viper.GetString("cardano_private_network.byron_genesis"),
+		ShelleyGenesis: viper.GetString("cardano_private_network.shelley_genesis"),
+		AlonzoGenesis:  viper.GetString("cardano_private_network.alonzo_genesis"),
+		ConwayGenesis:  viper.GetString("cardano_private_network.conway_genesis"),
+		ConfigTemplate: viper.GetString("cardano_private_network.config_template"),
+		Topology:       viper.GetString("cardano_private_network.topology"),
+	}
+}
+
+func (c *Config) IsPrivateNetwork() bool {
+	return c.CardanoNetwork == NetworkPrivate
+}
+
+func (c *Config) privateGenesisFiles() []privateGenesis {
+	files := []privateGenesis{
+		{era: GenesisByron, source: c.PrivateNetwork.ByronGenesis, fileName: privateByronGenesis},
+		{era: GenesisShelley, source: c.PrivateNetwork.ShelleyGenesis, fileName: privateShelleyGenesis},
+		{era: GenesisAlonzo, source: c.PrivateNetwork.AlonzoGenesis, fileName: privateAlonzoGenesis},
+		{era: GenesisConway, source: c.PrivateNetwork.ConwayGenesis, fileName: privateConwayGenesis},
+	}
+
+	configured := make([]privateGenesis, 0, len(files))
+	for i := range files {
+		if files[i].source != "" {
+			configured = append(configured, files[i])
+		}
+	}
+	return configured
+}
+
+func (c *Config) privateConfigFileNames() []string {
+	names := []string{newConfig, newTopology}
+	for _, genesis := range c.privateGenesisFiles() {
+		names = append(names, genesis.fileName)
+	}
+	return names
+}
+
+// setPrivateNetworkInit copies the user supplied genesis set into the node
+// configuration directory and generates a config.json declaring their hashes.
+// Nothing is downloaded for private networks.
+func (c *Config) setPrivateNetworkInit(configPath string) error {
+	genesisFiles := c.privateGenesisFiles()
+	if len(genesisFiles) == 0 || c.PrivateNetwork.ByronGenesis == "" || c.PrivateNetwork.ShelleyGenesis == "" {
+		return errors.New("private network requires at least byron_genesis and shelley_genesis")
+	}
+
+	if err := c.checkPrivateNetworkMagic(); err != nil {
+		return err
+	}
+
+	configTemplate := privateConfigTemplate
+	if c.PrivateNetwork.ConfigTemplate != "" {
+		data, err := ioutil.ReadFile(c.PrivateNetwork.ConfigTemplate)
+		if err != nil {
+			return errors.Annotatef(err, "reading config template %s", c.PrivateNetwork.ConfigTemplate)
+		}
+		configTemplate = string(data)
+	}
+
+	nodeConfig, err := ParseNodeConfig([]byte(configTemplate))
+	if err != nil {
+		return errors.Annotate(err, "parsing config template")
+	}
+	for _, genesis := range genesisFiles {
+		target := fmt.Sprintf("%s/%s", configPath, genesis.fileName)
+		if err := copyFile(genesis.source, target); err != nil {
+			return errors.Annotatef(err, "copying %s genesis", genesis.era)
+		}
+
+		hash, err := GenesisHash(genesis.era, target)
+		if err != nil {
+			return err
+		}
+		logrus.Infof("%s genesis hash: %s", genesis.era, hash)
+		nodeConfig.Genesis[genesis.era] = GenesisFile{File: genesis.fileName, Hash: hash}
+	}
+
+	if c.PrivateNetwork.ConwayGenesis != "" && c.PrivateNetwork.ConfigTemplate == "" {
+		if _, err := nodeConfig.Get("TestConwayHardForkAtEpoch"); errors.IsNotFound(err) {
+			if err = nodeConfig.Set("TestConwayHardForkAtEpoch", json.RawMessage("0")); err != nil {
+				return errors.Annotate(err, "setting conway hard fork epoch")
+			}
+		}
+	}
+
+	configFile := fmt.Sprintf("%s/%s", configPath, newConfig)
+	logrus.Info("writing private network config: ", configFile)
+	if err := nodeConfig.Save(configFile); err != nil {
+		return err
+	}
+
+	topologyFile := fmt.Sprintf("%s/%s", configPath, newTopology)
+	if c.PrivateNetwork.Topology != "" {
+		if err := copyFile(c.PrivateNetwork.Topology, topologyFile); err != nil {
+			return errors.Annotate(err, "copying topology")
+		}
+	} else if _, err := os.Stat(topologyFile); os.IsNotExist(err) {
+		logrus.Info("writing empty topology: ", topologyFile)
+		if err := ioutil.WriteFile(topologyFile, []byte(privateEmptyTopology), 0644); err != nil {
+			return errors.Annotatef(err, "writing to file %s", topologyFile)
+		}
+	}
+
+	return nil
+}
+
+// checkPrivateNetworkMagic makes sure the configured magic, when given,
+// matches the one declared in the shelley genesis.
+func (c *Config) checkPrivateNetworkMagic() error {
+	data, err := ioutil.ReadFile(c.PrivateNetwork.ShelleyGenesis)
+	if err != nil {
+		return errors.Annotatef(err, "reading shelley genesis %s", c.PrivateNetwork.ShelleyGenesis)
+	}
+
+	genesisMagic := gjson.GetBytes(data, "networkMagic").Int()
+	if c.PrivateNetwork.NetworkMagic == 0 {
+		c.PrivateNetwork.NetworkMagic = genesisMagic
+		return nil
+	}
+
+	if c.PrivateNetwork.NetworkMagic != genesisMagic {
+		return errors.Errorf("configured network magic %d does not match shelley genesis networkMagic %d",
+			c.PrivateNetwork.NetworkMagic, genesisMagic)
+	}
+	return nil
+}
+
+func copyFile(source, target string) error {
+	data, err := ioutil.ReadFile(source)
+	if err != nil {
+		return errors.Annotatef(err, "reading %s", source)
+	}
+	logrus.Infof("copying %s to %s", source, target)
+	if err := ioutil.WriteFile(target, data, 0644); err != nil {
+		return errors.Annotatef(err, "writing %s", target)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"os"
+	"path"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const defaultKeysContainer = "/home/lovelace/keys"
+
+const kesKeyName = "kes.skey"
+const vrfKeyName = "vrf.skey"
+const opCertName = "node.cert"
+
+// ProducerKeys are the host paths of the keys a block producer forges with.
+type ProducerKeys struct {
+	KESKey                 string
+	VRFKey                 string
+	OperationalCertificate string
+}
+
+type producerKey struct {
+	flag     string
+	hostPath string
+	name     string
+	private  bool
+}
+
+func (c *Config) SetProducerKeys() {
+	c.CardanoKeysContainer = viper.GetString("cardano_keys_container")
+	if c.CardanoKeysContainer == "" {
+		c.CardanoKeysContainer = defaultKeysContainer
+	}
+
+	c.ProducerKeys = ProducerKeys{
+		KESKey:                 viper.GetString("producer_keys.kes_key"),
+		VRFKey:                 viper.GetString("producer_keys.vrf_key"),
+		OperationalCertificate: viper.GetString("producer_keys.operational_certificate"),
+	}
+}
+
+func (c *Config) producerKeys() []producerKey {
+	return []producerKey{
+		{flag: "--shelley-kes-key", hostPath: c.ProducerKeys.KESKey, name: kesKeyName, private: true},
+		{flag: "--shelley-vrf-key", hostPath: c.ProducerKeys.VRFKey, name: vrfKeyName, private: true},
+		{flag: "--shelley-operational-certificate", hostPath: c.ProducerKeys.OperationalCertificate, name: opCertName},
+	}
+}
+
+// producerKeyMounts mounts every key read-only into the keys directory of
+// the container, each key file on its own.
+func (c *Config) producerKeyMounts() []mount.Mount {
+	keys := c.producerKeys()
+	mounts := make([]mount.Mount, 0, len(keys))
+	for _, key := range keys {
+		mounts = append(mounts, mount.Mount{
+			Type:     mount.TypeBind,
+			Source:   key.hostPath,
+			Target:   path.Join(c.CardanoKeysContainer, key.name),
+			ReadOnly: true,
+		})
+	}
+	return mounts
+}
+
+func (c *Config) producerKeyArgs() []string {
+	keys := c.producerKeys()
+	args := make([]string, 0, 2*len(keys))
+	for _, key := range keys {
+		args = append(args, key.flag, path.Join(c.CardanoKeysContainer, key.name))
+	}
+	return args
+}
+
+// CheckProducerKeys makes sure every producer key is configured and is a
+// regular file, and that the signing keys are not readable by group or
+// others: cardano-node refuses to start with a VRF key that is.
+func (c *Config) CheckProducerKeys() error {
+	for _, key := range c.producerKeys() {
+		if key.hostPath == "" {
+			return errors.Errorf("producer key for %s is not configured in producer_keys", key.flag)
+		}
+
+		info, err := os.Stat(key.hostPath)
+		if err != nil {
+			return errors.Annotatef(err, "producer key %s", key.hostPath)
+		}
+		if !info.Mode().IsRegular() {
+			return errors.Errorf("producer key %s is not a regular file", key.hostPath)
+		}
+
+		if key.private && info.Mode().Perm()&0077 != 0 {
+			return errors.Errorf("producer key %s has mode %04o, it must be 0600 or 0400",
+				key.hostPath, info.Mode().Perm())
+		}
+	}
+	return nil
+}
+
+func (c *Config) logProducerKeys() {
+	for _, key := range c.producerKeys() {
+		logrus.Infof("producer key %s: %s", key.name, key.hostPath)
+	}
+}
@@ -0,0 +1,195 @@
+package config
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// ChangeClass tells what has to happen to a running node for a changed
+// configuration key to take effect. Higher classes include the lower ones.
+type ChangeClass int
+
+const (
+	ChangeNone ChangeClass = iota
+	ChangeLive
+	ChangeRestart
+	ChangeRecreate
+)
+
+func (cc ChangeClass) String() string {
+	switch cc {
+	case ChangeLive:
+		return "live"
+	case ChangeRestart:
+		return "node restart"
+	case ChangeRecreate:
+		return "container recreation"
+	default:
+		return "none"
+	}
+}
+
+// changeClasses maps key prefixes to the class of their changes. Keys not
+// listed require the container to be recreated, the safest choice.
+var changeClasses = []struct {
+	prefix string
+	class  ChangeClass
+}{
+	{prefix: "container_id", class: ChangeNone},
+	{prefix: "log_level", class: ChangeLive},
+	{prefix: "alerts", class: ChangeLive},
+	{prefix: "topology", class: ChangeRestart},
+	{prefix: "pool_layout", class: ChangeRestart},
+	{prefix: "topology_updater", class: ChangeRestart},
+	{prefix: "cardano_hasprometheus", class: ChangeRestart},
+	{prefix: "cardano_tracers", class: ChangeRestart},
+	{prefix: "cardano_log", class: ChangeRestart},
+}
+
+// Settings returns the effective value of every configuration key.
+func Settings() map[string]interface{} {
+	settings := make(map[string]interface{})
+	for _, key := range viper.AllKeys() {
+		settings[key] = viper.Get(key)
+	}
+	return settings
+}
+
+// RestoreSettings puts a Settings snapshot back in place of a reloaded
+// configuration that could not be applied. viper is set up again as Load
+// does, so the config file and the GOCARD_ environment stay bound.
+func RestoreSettings(settings map[string]interface{}) {
+	viper.Reset()
+	base := ConfigFileUsed()
+	if base == "" {
+		base = loadedFile
+	}
+	if err := setup(base); err != nil {
+		logrus.Warn("restoring settings: ", err.Error())
+	}
+	for key, value := range settings {
+		viper.Set(key, value)
+	}
+	ApplyLogLevel()
+}
+
+// ClassifyChanges compares two Settings snapshots and returns the class of
+// every key that was added, removed or modified.
+func ClassifyChanges(before, after map[string]interface{}) map[string]ChangeClass {
+	changes := make(map[string]ChangeClass)
+	for key, value := range after {
+		if old, ok := before[key]; !ok || !reflect.DeepEqual(old, value) {
+			changes[key] = classify(key)
+		}
+	}
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			changes[key] = classify(key)
+		}
+	}
+	for key, class := range changes {
+		if class == ChangeNone {
+			delete(changes, key)
+		}
+	}
+	return changes
+}
+
+// MaxChangeClass returns the highest class in changes.
+func MaxChangeClass(changes map[string]ChangeClass) ChangeClass {
+	highest := ChangeNone
+	for _, class := range changes {
+		if class > highest {
+			highest = class
+		}
+	}
+	return highest
+}
+
+// LogChanges logs every change with its class, sorted by key.
+func LogChanges(changes map[string]ChangeClass) {
+	keys := make([]string, 0, len(changes))
+	for key := range changes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		logrus.Infof("config change: %s (%s)", key, changes[key])
+	}
+}
+
+func classify(key string) ChangeClass {
+	for _, cc := range changeClasses {
+		if key == cc.prefix || strings.HasPrefix(key, cc.prefix+".") || strings.HasPrefix(key, cc.prefix+"_") {
+			return cc.class
+		}
+	}
+	return ChangeRecreate
+}
+
+// WatchLayers sends on the returned channel whenever one of the loaded
+// configuration files changes. Editors often replace files instead of
+// writing them, so the directories are watched and events are debounced.
+func WatchLayers() (<-chan struct{}, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, errors.Annotate(err, "creating config watcher")
+	}
+
+	files := make(map[string]struct{})
+	dirs := make(map[string]struct{})
+	for _, layer := range Layers() {
+		if layer.Name == LayerPidFile {
+			continue
+		}
+		path := filepath.Clean(layer.Path)
+		files[path] = struct{}{}
+		dirs[filepath.Dir(path)] = struct{}{}
+	}
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return nil, errors.Annotatef(err, "watching %s", dir)
+		}
+		logrus.Info("watching config dir: ", dir)
+	}
+
+	changed := make(chan struct{}, 1)
+	go func() {
+		var debounce <-chan time.Time
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if _, watched := files[filepath.Clean(event.Name)]; !watched {
+					continue
+				}
+				logrus.Debugf("config file event: %s", event.String())
+				debounce = time.After(500 * time.Millisecond)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logrus.Error("config watcher: ", err.Error())
+			case <-debounce:
+				debounce = nil
+				select {
+				case changed <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	return changed, nil
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		key  string
+		want ChangeClass
+	}{
+		{"container_id", ChangeNone},
+		{"log_level", ChangeLive},
+		{"alerts.telegram.chat_id", ChangeLive},
+		{"topology_updater.interval", ChangeRestart},
+		{"cardano_tracers.preset", ChangeRestart},
+		{"docker_image", ChangeRecreate},
+	}
+	for _, tt := range tests {
+		if got := classify(tt.key); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestRestoreSettings(t *testing.T) {
+	defer viper.Reset()
+	dir := t.TempDir()
+	file := filepath.Join(dir, "gocard.yaml")
+	if err := ioutil.WriteFile(file, []byte("node_name: before\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Load(file, nil); err != nil {
+		t.Fatal(err)
+	}
+	settings := Settings()
+
+	if err := ioutil.WriteFile(file, []byte("node_name: [broken\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Reload(); err == nil {
+		t.Fatal("expected the broken file to fail")
+	}
+	RestoreSettings(settings)
+
+	if got := viper.GetString("node_name"); got != "before" {
+		t.Errorf("node_name is %q after restoring", got)
+	}
+	if got := ConfigFileUsed(); got != file {
+		t.Errorf("config file is %q after restoring", got)
+	}
+	if got := viper.ConfigFileUsed(); got != file {
+		t.Errorf("viper config file is %q after restoring", got)
+	}
+
+	os.Setenv(EnvVarName("docker_image"), "from-env")
+	defer os.Unsetenv(EnvVarName("docker_image"))
+	if got := viper.GetString("docker_image"); got != "from-env" {
+		t.Errorf("the environment is no longer bound, docker_image is %q", got)
+	}
+}
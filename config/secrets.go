@@ -0,0 +1,319 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Configuration values starting with one of these prefixes are references
+// resolved when the configuration is loaded:
+//
+//   file:/path/to/file   the contents of the file, without the trailing newline
+//   env:NAME             the value of the environment variable NAME
+//   secret:NAME          the entry NAME of the encrypted secrets file
+const SecretRefFile = "file:"
+const SecretRefEnv = "env:"
+const SecretRefSecret = "secret:"
+
+// SecretsPassphraseEnv holds the passphrase of the encrypted secrets file.
+const SecretsPassphraseEnv = "GOCARD_SECRETS_PASSPHRASE"
+
+const secretsFileName = "gocard.secrets"
+const secretMask = "******"
+
+// secretKeys are the configuration keys whose value came from a reference.
+var secretKeys = map[string]struct{}{}
+
+var redactHook = &secretRedactHook{values: map[string]*regexp.Regexp{}}
+var redactOnce sync.Once
+
+type secretsFile struct {
+	Salt  []byte `json:"salt"`
+	Nonce []byte `json:"nonce"`
+	Data  []byte `json:"data"`
+}
+
+// IsSecret reports whether the value of key was resolved from a reference
+// and must not be shown.
+func IsSecret(key string) bool {
+	_, ok := secretKeys[key]
+	return ok
+}
+
+// ResolveSecrets replaces every reference in the loaded configuration, in
+// values and list elements, with the value it points to. The resolved values
+// are masked in any log entry.
+func ResolveSecrets() error {
+	secretKeys = map[string]struct{}{}
+	redactOnce.Do(func() { logrus.AddHook(redactHook) })
+
+	r := &refResolver{}
+	for _, key := range viper.AllKeys() {
+		switch value := viper.Get(key).(type) {
+		case string:
+			if !isSecretRef(value) {
+				continue
+			}
+			resolved, err := r.resolve(key, value)
+			if err != nil {
+				return err
+			}
+			viper.Set(key, resolved)
+		case []interface{}:
+			// lists such as container_env or cardano_extra_args
+			resolved, found := make([]interface{}, len(value)), false
+			for i, item := range value {
+				resolved[i] = item
+				if ref, ok := item.(string); ok && isSecretRef(ref) {
+					var err error
+					if resolved[i], err = r.resolve(fmt.Sprintf("%s[%d]", key, i), ref); err != nil {
+						return err
+					}
+					found = true
+				}
+			}
+			if !found {
+				continue
+			}
+			viper.Set(key, resolved)
+		default:
+			continue
+		}
+		secretKeys[key] = struct{}{}
+	}
+	return nil
+}
+
+// refResolver resolves references, reading the secrets file once.
+type refResolver struct {
+	secrets map[string]string
+}
+
+// resolve returns the value ref points to and masks it in the logs. key
+// names the configuration value in errors.
+func (r *refResolver) resolve(key, ref string) (string, error) {
+	var resolved string
+	switch {
+	case strings.HasPrefix(ref, SecretRefFile):
+		path := strings.TrimPrefix(ref, SecretRefFile)
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", errors.Annotatef(err, "resolving %s", key)
+		}
+		resolved = strings.TrimRight(string(data), "\r\n")
+	case strings.HasPrefix(ref, SecretRefEnv):
+		name := strings.TrimPrefix(ref, SecretRefEnv)
+		env, found := os.LookupEnv(name)
+		if !found {
+			return "", errors.Errorf("resolving %s: environment variable %s is not set", key, name)
+		}
+		resolved = env
+	case strings.HasPrefix(ref, SecretRefSecret):
+		if r.secrets == nil {
+			var err error
+			if r.secrets, err = ReadSecrets(); err != nil {
+				return "", errors.Annotatef(err, "resolving %s", key)
+			}
+		}
+		name := strings.TrimPrefix(ref, SecretRefSecret)
+		secret, found := r.secrets[name]
+		if !found {
+			return "", errors.Errorf("resolving %s: secret %s not found in %s", key, name, SecretsFilePath())
+		}
+		resolved = secret
+	}
+	redactHook.add(resolved)
+	return resolved, nil
+}
+
+func isSecretRef(value string) bool {
+	return strings.HasPrefix(value, SecretRefFile) ||
+		strings.HasPrefix(value, SecretRefEnv) ||
+		strings.HasPrefix(value, SecretRefSecret)
+}
+
+// SecretsFilePath returns secrets_file or, when not set, gocard.secrets next
+// to the base config file.
+func SecretsFilePath() string {
+	if path := viper.GetString("secrets_file"); path != "" {
+		return path
+	}
+	dir := "."
+	if base := ConfigFileUsed(); base != "" {
+		dir = filepath.Dir(base)
+	}
+	return filepath.Join(dir, secretsFileName)
+}
+
+// ReadSecrets decrypts the secrets file. A missing file holds no secrets.
+func ReadSecrets() (map[string]string, error) {
+	path := SecretsFilePath()
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, errors.Annotatef(err, "reading secrets file %s", path)
+	}
+
+	sf := &secretsFile{}
+	if err = json.Unmarshal(data, sf); err != nil {
+		return nil, errors.Annotatef(err, "parsing secrets file %s", path)
+	}
+
+	gcm, err := secretsCipher(sf.Salt)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := gcm.Open(nil, sf.Nonce, sf.Data, nil)
+	if err != nil {
+		return nil, errors.Errorf("could not decrypt %s, wrong passphrase?", path)
+	}
+
+	secrets := map[string]string{}
+	if err = json.Unmarshal(plain, &secrets); err != nil {
+		return nil, errors.Annotate(err, "parsing decrypted secrets")
+	}
+	return secrets, nil
+}
+
+// WriteSecrets encrypts secrets with a fresh salt and nonce and replaces
+// the secrets file.
+func WriteSecrets(secrets map[string]string) error {
+	plain, err := json.Marshal(secrets)
+	if err != nil {
+		return errors.Annotate(err, "encoding secrets")
+	}
+
+	sf := &secretsFile{Salt: make([]byte, 16)}
+	if _, err = rand.Read(sf.Salt); err != nil {
+		return errors.Annotate(err, "generating salt")
+	}
+	gcm, err := secretsCipher(sf.Salt)
+	if err != nil {
+		return err
+	}
+	sf.Nonce = make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(sf.Nonce); err != nil {
+		return errors.Annotate(err, "generating nonce")
+	}
+	sf.Data = gcm.Seal(nil, sf.Nonce, plain, nil)
+
+	data, err := json.Marshal(sf)
+	if err != nil {
+		return errors.Annotate(err, "encoding secrets file")
+	}
+
+	path := SecretsFilePath()
+	tmp := path + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return errors.Annotatef(err, "writing %s", tmp)
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		return errors.Annotatef(err, "writing %s", path)
+	}
+	return nil
+}
+
+// SecretNames returns the sorted names in the secrets file.
+func SecretNames() ([]string, error) {
+	secrets, err := ReadSecrets()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(secrets))
+	for name := range secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func secretsCipher(salt []byte) (cipher.AEAD, error) {
+	passphrase, ok := os.LookupEnv(SecretsPassphraseEnv)
+	if !ok || passphrase == "" {
+		return nil, errors.Errorf("%s is not set", SecretsPassphraseEnv)
+	}
+
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, errors.Annotate(err, "deriving secrets key")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Annotate(err, "creating secrets cipher")
+	}
+	return cipher.NewGCM(block)
+}
+
+// secretRedactHook masks resolved secret values in every log entry.
+type secretRedactHook struct {
+	mu     sync.RWMutex
+	values map[string]*regexp.Regexp
+}
+
+// shortSecretLen is the length under which a value is only masked where it
+// stands alone, masking every occurrence would mangle unrelated words.
+const shortSecretLen = 4
+
+func (h *secretRedactHook) add(value string) {
+	if value == "" {
+		return
+	}
+	var standalone *regexp.Regexp
+	if len(value) < shortSecretLen {
+		standalone = regexp.MustCompile(`(^|[^\w])` + regexp.QuoteMeta(value) + `([^\w]|$)`)
+	}
+	h.mu.Lock()
+	h.values[value] = standalone
+	h.mu.Unlock()
+}
+
+func (h *secretRedactHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *secretRedactHook) Fire(entry *logrus.Entry) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for value, standalone := range h.values {
+		entry.Message = mask(entry.Message, value, standalone)
+		for k, v := range entry.Data {
+			if s, ok := v.(string); ok {
+				entry.Data[k] = mask(s, value, standalone)
+			} else if s := fmt.Sprint(v); mask(s, value, standalone) != s {
+				entry.Data[k] = secretMask
+			}
+		}
+	}
+	return nil
+}
+
+// mask replaces value in s, only where it stands alone when standalone is
+// set.
+func mask(s, value string, standalone *regexp.Regexp) string {
+	if standalone == nil {
+		return strings.ReplaceAll(s, value, secretMask)
+	}
+	// the separators are part of the matches, so adjacent occurrences need
+	// a second pass
+	for i := 0; i < 2; i++ {
+		s = standalone.ReplaceAllString(s, "${1}"+secretMask+"${2}")
+	}
+	return s
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestSecrets(t *testing.T) {
+	defer viper.Reset()
+	os.Setenv(SecretsPassphraseEnv, "correct horse")
+	defer os.Unsetenv(SecretsPassphraseEnv)
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "gocard.yaml")
+	yaml := "node_name: relay1\nalerts:\n  telegram:\n    token: secret:telegram_token\n"
+	if err := ioutil.WriteFile(file, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the secret is missing: only the commands keeping references can load
+	if err := Load(file, nil); err == nil {
+		t.Fatal("expected the missing secret to fail")
+	}
+	if err := LoadReferences(file, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := viper.GetString("alerts.telegram.token"); got != "secret:telegram_token" {
+		t.Errorf("reference is %q, want it kept", got)
+	}
+
+	secrets := map[string]string{"telegram_token": "123456:ABCDEF"}
+	if err := WriteSecrets(secrets); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, secretsFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("ABCDEF")) {
+		t.Error("the secrets file holds the secret in clear")
+	}
+
+	got, err := ReadSecrets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, secrets) {
+		t.Errorf("decrypted %v, want %v", got, secrets)
+	}
+
+	viper.Reset()
+	if err = Load(file, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := viper.GetString("alerts.telegram.token"); got != "123456:ABCDEF" {
+		t.Errorf("resolved %q", got)
+	}
+	if !IsSecret("alerts.telegram.token") || IsSecret("node_name") {
+		t.Error("only the resolved key must be secret")
+	}
+	var out bytes.Buffer
+	if err = WriteSettings(&out); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "ABCDEF") {
+		t.Errorf("config show reveals the secret:\n%s", out.String())
+	}
+
+	os.Setenv(SecretsPassphraseEnv, "wrong")
+	if _, err = ReadSecrets(); err == nil {
+		t.Error("expected the wrong passphrase to fail")
+	}
+}
@@ -0,0 +1,73 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/viper"
+)
+
+const SourceEnv = "env"
+const SourceFile = "file"
+
+// WriteSettings prints the effective configuration, one key per line, along
+// with where each value came from.
+func WriteSettings(w io.Writer) error {
+	fmt.Fprintln(w, "precedence (highest first): GOCARD_* environment, pid file, profiles (last first), base config file")
+	fmt.Fprintln(w, "config files (merged in order):")
+	for _, layer := range Layers() {
+		fmt.Fprintf(w, "  %-8s %s\n", layer.Name, layer.Path)
+	}
+	fmt.Fprintln(w)
+
+	keys := viper.AllKeys()
+	sort.Strings(keys)
+
+	known := make(map[string]struct{}, len(keys))
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tVALUE\tSOURCE")
+	for _, key := range keys {
+		known[EnvVarName(key)] = struct{}{}
+		source := fmt.Sprintf("%s (%s)", SourceFile, keyLayer[key])
+		if envOverride(key) {
+			source = fmt.Sprintf("%s (%s)", SourceEnv, EnvVarName(key))
+		}
+		var value interface{} = viper.Get(key)
+		if IsSecret(key) {
+			value = secretMask
+			source += ", secret reference"
+		} else if ref, ok := value.(string); ok && isSecretRef(ref) {
+			// loaded with LoadReferences, the reference itself is shown
+			source += ", unresolved reference"
+		}
+		fmt.Fprintf(tw, "%s\t%v\t%s\n", key, value, source)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	unmatched := make([]string, 0)
+	for _, env := range os.Environ() {
+		name := strings.SplitN(env, "=", 2)[0]
+		if !strings.HasPrefix(name, EnvPrefix+"_") {
+			continue
+		}
+		if _, ok := known[name]; !ok {
+			unmatched = append(unmatched, name)
+		}
+	}
+	if len(unmatched) > 0 {
+		sort.Strings(unmatched)
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "environment variables not matching a config file key:")
+		for _, name := range unmatched {
+			fmt.Fprintln(w, "  ", name)
+		}
+	}
+
+	return nil
+}
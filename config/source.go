@@ -0,0 +1,278 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const SourceAuto = "auto"
+const SourceHTTP = "http"
+const SourceLocal = "local"
+const SourceEmbedded = "embedded"
+
+// bundles holds known-good configuration sets, one directory per network,
+// each pinned by the checksums of its SHA256SUMS file, see the bundles
+// target of the Makefile. Release builds refuse to build without the mainnet
+// set, see bundle_release.go.
+//go:embed bundles
+var bundles embed.FS
+
+// bundleSums lists the sha256 of every file of a bundle, in the format of
+// sha256sum.
+const bundleSums = "SHA256SUMS"
+
+// ConfigSource provides the published cardano configuration files.
+type ConfigSource interface {
+	// Name describes the source in logs and errors.
+	Name() string
+	// Fetch writes the file published as name to target.
+	Fetch(name, target string) error
+}
+
+// ConfigSource returns the source selected with cardano_config_source:
+//
+//   http      cardano_latest_config, then every cardano_config_mirrors URL
+//   local     the files found in cardano_config_dir
+//   embedded  the bundle built into gocard for cardano_network, works offline
+//   auto      http, falling back to embedded (the default)
+func (c *Config) ConfigSource() (ConfigSource, error) {
+	kind := viper.GetString("cardano_config_source")
+	if kind == "" {
+		kind = SourceAuto
+	}
+
+	switch kind {
+	case SourceHTTP:
+		return c.httpConfigSource(), nil
+	case SourceLocal:
+		dir := viper.GetString("cardano_config_dir")
+		if dir == "" {
+			return nil, errors.New("cardano_config_source local requires cardano_config_dir")
+		}
+		return &dirSource{dir: dir}, nil
+	case SourceEmbedded:
+		if !hasBundle(c.CardanoNetwork) {
+			return nil, errors.Errorf("gocard was built without the %s bundle, build it with `make release` "+
+				"or set another cardano_config_source", c.CardanoNetwork)
+		}
+		return newEmbeddedSource(c.CardanoNetwork), nil
+	case SourceAuto:
+		sources := []ConfigSource{c.httpConfigSource()}
+		if hasBundle(c.CardanoNetwork) {
+			sources = append(sources, newEmbeddedSource(c.CardanoNetwork))
+		} else {
+			logrus.Warnf("gocard was built without the %s bundle, there is no offline fallback", c.CardanoNetwork)
+		}
+		return &fallbackSource{sources: sources}, nil
+	default:
+		return nil, errors.Errorf("unknown cardano_config_source: %s", kind)
+	}
+}
+
+func (c *Config) httpConfigSource() *httpSource {
+	urls := make([]string, 0, 4)
+	if configURL := viper.GetString("cardano_latest_config"); configURL != "" {
+		urls = append(urls, configURL)
+	} else {
+		urls = append(urls, fmt.Sprintf(cardanoConfigURL, c.CardanoNetwork))
+	}
+	urls = append(urls, viper.GetStringSlice("cardano_config_mirrors")...)
+
+	timeout := viper.GetDuration("cardano_download.timeout")
+	if timeout == 0 {
+		timeout = defaultDownloadTimeout
+	}
+	retries := defaultDownloadRetries
+	if viper.IsSet("cardano_download.retries") {
+		retries = viper.GetInt("cardano_download.retries")
+	}
+
+	return &httpSource{
+		urls:     urls,
+		client:   &http.Client{Timeout: timeout},
+		retries:  retries,
+		backoff:  time.Second,
+		cacheDir: downloadCacheDir(),
+	}
+}
+
+// httpSource downloads files from the first base URL that serves them.
+type httpSource struct {
+	urls     []string
+	client   *http.Client
+	retries  int
+	backoff  time.Duration
+	cacheDir string
+}
+
+func (s *httpSource) Name() string {
+	return fmt.Sprintf("http %s", strings.Join(s.urls, ", "))
+}
+
+func (s *httpSource) Fetch(name, target string) error {
+	var lastErr error
+	for _, baseURL := range s.urls {
+		url := fmt.Sprintf("%s/%s", strings.TrimSuffix(baseURL, "/"), name)
+		if lastErr = s.download(url, target); lastErr == nil {
+			return nil
+		}
+		logrus.Warnf("could not download %s: %s", url, lastErr.Error())
+	}
+	return errors.Annotatef(lastErr, "downloading %s", name)
+}
+
+// dirSource copies files from a local directory.
+type dirSource struct {
+	dir string
+}
+
+func (s *dirSource) Name() string {
+	return fmt.Sprintf("local %s", s.dir)
+}
+
+func (s *dirSource) Fetch(name, target string) error {
+	in, err := os.Open(filepath.Join(s.dir, name))
+	if err != nil {
+		return errors.Annotatef(err, "opening %s", name)
+	}
+	defer in.Close()
+
+	logrus.Infof("copying %s from %s to %s", name, s.dir, target)
+	return writeFile(in, target)
+}
+
+// embeddedSource copies files from the bundle of a network built into gocard.
+// Every file is checked against the checksum pinned in the bundle.
+type embeddedSource struct {
+	network string
+	fsys    fs.FS
+}
+
+func newEmbeddedSource(network string) *embeddedSource {
+	return &embeddedSource{network: network, fsys: bundles}
+}
+
+func (s *embeddedSource) Name() string {
+	return fmt.Sprintf("embedded %s bundle", s.network)
+}
+
+func (s *embeddedSource) Fetch(name, target string) error {
+	sums, err := bundleChecksums(s.fsys, s.network)
+	if err != nil {
+		return err
+	}
+	want, ok := sums[name]
+	if !ok {
+		return errors.Errorf("%s not in the embedded %s bundle", name, s.network)
+	}
+	data, err := fs.ReadFile(s.fsys, path.Join("bundles", s.network, name))
+	if err != nil {
+		return errors.Annotatef(err, "%s not in the embedded %s bundle", name, s.network)
+	}
+	if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != want {
+		return errors.Errorf("%s of the embedded %s bundle does not match its pinned checksum", name, s.network)
+	}
+
+	logrus.Infof("copying embedded %s to %s", name, target)
+	return writeFile(bytes.NewReader(data), target)
+}
+
+// bundleChecksums reads the pinned sha256 of every file of the bundle of
+// network, by file name.
+func bundleChecksums(fsys fs.FS, network string) (map[string]string, error) {
+	sumsPath := path.Join("bundles", network, bundleSums)
+	data, err := fs.ReadFile(fsys, sumsPath)
+	if err != nil {
+		return nil, errors.Annotatef(err, "reading %s", sumsPath)
+	}
+
+	sums := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 || len(fields[0]) != sha256.Size*2 {
+			return nil, errors.Errorf("%s: invalid line %q", sumsPath, scanner.Text())
+		}
+		// sha256sum marks files read in binary mode with a *
+		sums[strings.TrimPrefix(fields[1], "*")] = strings.ToLower(fields[0])
+	}
+	return sums, scanner.Err()
+}
+
+// hasBundle reports whether gocard was built with the configuration set of
+// network, which holds at least its config.json and the pinned checksums.
+func hasBundle(network string) bool {
+	for _, name := range []string{config, bundleSums} {
+		if _, err := fs.Stat(bundles, path.Join("bundles", network, name)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// fallbackSource tries each source in turn.
+type fallbackSource struct {
+	sources []ConfigSource
+}
+
+func (s *fallbackSource) Name() string {
+	names := make([]string, 0, len(s.sources))
+	for _, source := range s.sources {
+		names = append(names, source.Name())
+	}
+	return strings.Join(names, ", then ")
+}
+
+func (s *fallbackSource) Fetch(name, target string) error {
+	var lastErr error
+	for _, source := range s.sources {
+		if lastErr = source.Fetch(name, target); lastErr == nil {
+			return nil
+		}
+		logrus.Warnf("%s: %s", source.Name(), lastErr.Error())
+	}
+	return lastErr
+}
+
+// writeFile writes in to a temporary file next to target and renames it
+// into place, so target is never left truncated.
+func writeFile(in io.Reader, target string) error {
+	dir, base := filepath.Split(target)
+	tmp, err := ioutil.TempFile(dir, "."+base+".*.tmp")
+	if err != nil {
+		return errors.Annotatef(err, "creating temporary file for %s", target)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		return errors.Annotatef(err, "writing %s", tmp.Name())
+	}
+	if err = tmp.Close(); err != nil {
+		return errors.Annotatef(err, "closing %s", tmp.Name())
+	}
+	if err = os.Chmod(tmp.Name(), 0644); err != nil {
+		return errors.Annotatef(err, "setting mode of %s", tmp.Name())
+	}
+	return os.Rename(tmp.Name(), target)
+}
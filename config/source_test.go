@@ -0,0 +1,256 @@
+package config
+
+import (
+	"bytes"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/spf13/viper"
+)
+
+// newTestServer serves body as JSON under /good/ and fails everywhere else
+// with status.
+func newTestServer(t *testing.T, body string, status int) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if filepath.Dir(r.URL.Path) != "/good" {
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestHTTPSource(t *testing.T, srv *httptest.Server, paths ...string) *httpSource {
+	urls := make([]string, 0, len(paths))
+	for _, p := range paths {
+		urls = append(urls, srv.URL+p)
+	}
+	return &httpSource{urls: urls, client: srv.Client(), cacheDir: t.TempDir()}
+}
+
+func readTarget(t *testing.T, target string) string {
+	data, err := ioutil.ReadFile(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestHTTPSourceFetch(t *testing.T) {
+	srv := newTestServer(t, `{"source":"http"}`, http.StatusNotFound)
+
+	tests := []struct {
+		name    string
+		paths   []string
+		wantErr bool
+	}{
+		{"first url", []string{"/good"}, false},
+		{"mirror after a missing file", []string{"/bad", "/good/"}, false},
+		{"no url serves the file", []string{"/bad", "/worse"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := filepath.Join(t.TempDir(), newConfig)
+			err := newTestHTTPSource(t, srv, tt.paths...).Fetch(config, target)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := readTarget(t, target); got != `{"source":"http"}` {
+				t.Errorf("got %s", got)
+			}
+		})
+	}
+}
+
+func TestHTTPSourceRetries(t *testing.T) {
+	failures := 2
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	source := &httpSource{urls: []string{srv.URL}, client: srv.Client(), retries: 2, cacheDir: t.TempDir()}
+	if err := source.Fetch(config, filepath.Join(t.TempDir(), newConfig)); err != nil {
+		t.Fatal(err)
+	}
+	if failures != 0 {
+		t.Errorf("%d failures left", failures)
+	}
+}
+
+func TestFallbackSourceOrder(t *testing.T) {
+	srv := newTestServer(t, `{"source":"http"}`, http.StatusInternalServerError)
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, config), []byte(`{"source":"local"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	local := &dirSource{dir: dir}
+
+	tests := []struct {
+		name    string
+		sources []ConfigSource
+		want    string
+	}{
+		{"first source serves", []ConfigSource{newTestHTTPSource(t, srv, "/good"), local}, `{"source":"http"}`},
+		{"falls back when it fails", []ConfigSource{newTestHTTPSource(t, srv, "/bad"), local}, `{"source":"local"}`},
+		{"order is kept", []ConfigSource{local, newTestHTTPSource(t, srv, "/good")}, `{"source":"local"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := filepath.Join(t.TempDir(), newConfig)
+			if err := (&fallbackSource{sources: tt.sources}).Fetch(config, target); err != nil {
+				t.Fatal(err)
+			}
+			if got := readTarget(t, target); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	source := &fallbackSource{sources: []ConfigSource{newTestHTTPSource(t, srv, "/bad"), &dirSource{dir: t.TempDir()}}}
+	if err := source.Fetch(config, filepath.Join(t.TempDir(), newConfig)); err == nil {
+		t.Error("expected an error when every source fails")
+	}
+}
+
+func TestConfigSourceAuto(t *testing.T) {
+	defer viper.Reset()
+	viper.Set("cardano_config_source", SourceAuto)
+	viper.Set("cardano_latest_config", "http://127.0.0.1:1/config")
+	viper.Set("cardano_config_mirrors", []string{"http://127.0.0.1:1/mirror"})
+
+	c := &Config{CardanoNetwork: NetworkPreview}
+	source, err := c.ConfigSource()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fallback, ok := source.(*fallbackSource)
+	if !ok {
+		t.Fatalf("auto is a %T", source)
+	}
+
+	first, ok := fallback.sources[0].(*httpSource)
+	if !ok {
+		t.Fatalf("auto starts with a %T", fallback.sources[0])
+	}
+	if len(first.urls) != 2 || first.urls[0] != "http://127.0.0.1:1/config" || first.urls[1] != "http://127.0.0.1:1/mirror" {
+		t.Errorf("unexpected urls %v", first.urls)
+	}
+
+	if !hasBundle(c.CardanoNetwork) {
+		if len(fallback.sources) != 1 {
+			t.Errorf("auto falls back to %d sources without a bundle", len(fallback.sources)-1)
+		}
+		viper.Set("cardano_config_source", SourceEmbedded)
+		if _, err = c.ConfigSource(); err == nil {
+			t.Error("embedded without a bundle must fail")
+		}
+		return
+	}
+	if len(fallback.sources) != 2 {
+		t.Fatalf("auto has %d sources", len(fallback.sources))
+	}
+	if _, ok = fallback.sources[1].(*embeddedSource); !ok {
+		t.Errorf("auto falls back to a %T", fallback.sources[1])
+	}
+}
+
+// TestEmbeddedBundles fetches the set of every bundled network through the
+// embedded source, as node init does, and checks the files against the
+// pinned checksums and the genesis hashes config.json declares.
+func TestEmbeddedBundles(t *testing.T) {
+	for _, network := range []string{NetworkMainnet, NetworkPreview} {
+		t.Run(network, func(t *testing.T) {
+			if !hasBundle(network) {
+				t.Skipf("no %s bundle, pin it with make bundle-pin NETWORK=%s", network, network)
+			}
+			sums, err := bundleChecksums(bundles, network)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			c := &Config{CardanoBaseLocal: t.TempDir()}
+			configDir := filepath.Join(c.CardanoBaseLocal, "config")
+			if err = fetchConfigSet(newEmbeddedSource(network), configDir, false); err != nil {
+				t.Fatal(err)
+			}
+			if err = c.VerifyGenesisHashes(); err != nil {
+				t.Fatal(err)
+			}
+
+			for name := range sums {
+				served, err := ioutil.ReadFile(filepath.Join(configDir, name))
+				if err != nil {
+					t.Errorf("%s is pinned but was not fetched: %s", name, err)
+					continue
+				}
+				bundled, err := fs.ReadFile(bundles, path.Join("bundles", network, name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(served, bundled) {
+					t.Errorf("%s differs from the bundle", name)
+				}
+			}
+		})
+	}
+}
+
+func TestEmbeddedSourceChecksum(t *testing.T) {
+	fsys := fstest.MapFS{
+		"bundles/test/SHA256SUMS": {Data: []byte(
+			"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855  empty.json\n" +
+				"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855 *tampered.json\n")},
+		"bundles/test/empty.json":    {Data: []byte{}},
+		"bundles/test/tampered.json": {Data: []byte("{}")},
+		"bundles/test/unpinned.json": {Data: []byte("{}")},
+	}
+	source := &embeddedSource{network: "test", fsys: fsys}
+
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{"empty.json", false},
+		{"tampered.json", true},
+		{"unpinned.json", true},
+		{"missing.json", true},
+	}
+	for _, tt := range tests {
+		target := filepath.Join(t.TempDir(), tt.name)
+		err := source.Fetch(tt.name, target)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error", tt.name)
+			}
+			if _, statErr := os.Stat(target); statErr == nil {
+				t.Errorf("%s: written despite the error", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+		}
+	}
+}
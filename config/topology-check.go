@@ -0,0 +1,76 @@
+package config
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strconv"
+
+	"github.com/juju/errors"
+	"github.com/spf13/viper"
+
+	topo "github.com/adakailabs/gocard/topology"
+)
+
+// TopologyFile is the topology.json the node runs with.
+func (c *Config) TopologyFile() string {
+	return filepath.Join(c.CardanoBaseLocal, "config", newTopology)
+}
+
+// CheckTopology checks a topology.json of this node, the node's own one
+// when file is empty. See topology.Check for the issues looked for.
+func (c *Config) CheckTopology(ctx context.Context, file string) ([]topo.Issue, error) {
+	if file == "" {
+		file = c.TopologyFile()
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.Annotatef(err, "reading %s", file)
+	}
+	parsed, err := topo.Parse(data)
+	if err != nil {
+		return nil, errors.Annotate(err, file)
+	}
+
+	opts, err := c.topologyCheckOptions()
+	if err != nil {
+		return nil, err
+	}
+	return topo.Check(ctx, parsed, opts), nil
+}
+
+// topologyCheckOptions describes this node: it is reachable at its
+// cardano_host_address and, when pool_layout is set, at its entry there.
+// The layout's producer is the one that must not be shared.
+func (c *Config) topologyCheckOptions() (topo.CheckOptions, error) {
+	opts := topo.CheckOptions{IsProducer: c.IsProducer}
+
+	if c.CardanoHostAddress != "" && c.CardanoPort != "" {
+		port, err := strconv.Atoi(c.CardanoPort)
+		if err != nil {
+			return opts, errors.Annotatef(err, "cardano_port %q", c.CardanoPort)
+		}
+		if ip := net.ParseIP(c.CardanoHostAddress); ip == nil || !ip.IsUnspecified() {
+			opts.Self = append(opts.Self, topo.AccessPoint{Address: c.CardanoHostAddress, Port: port})
+		}
+	}
+
+	layout, err := PoolLayout()
+	if err != nil || layout == nil {
+		return opts, err
+	}
+	producer := topo.AccessPoint{Address: layout.Producer.Address, Port: layout.Producer.Port}
+	opts.Producers = append(opts.Producers, producer)
+	if c.IsProducer {
+		opts.Self = append(opts.Self, producer)
+		return opts, nil
+	}
+	self := viper.GetString("server_name")
+	for _, relay := range layout.Relays {
+		if relay.Name == self {
+			opts.Self = append(opts.Self, topo.AccessPoint{Address: relay.Address, Port: relay.Port})
+		}
+	}
+	return opts, nil
+}
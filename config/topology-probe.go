@@ -0,0 +1,108 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+
+	topo "github.com/adakailabs/gocard/topology"
+)
+
+const probedPeersName = "topology-probe.json"
+
+// ProbeCandidates returns the peers of the local topology.json, followed by
+// the peers last fetched by the topology updater, which carry a region.
+func (c *Config) ProbeCandidates() ([]topo.Peer, error) {
+	topologyFile := c.TopologyFile()
+	data, err := ioutil.ReadFile(topologyFile)
+	if err != nil {
+		return nil, errors.Annotatef(err, "reading %s", topologyFile)
+	}
+	file, err := topo.Parse(data)
+	if err != nil {
+		return nil, errors.Annotate(err, topologyFile)
+	}
+
+	fetched, err := readPeers(c.updaterPeersFile())
+	if err != nil {
+		return nil, err
+	}
+	// the fetched peers come first so their region is kept
+	return topo.MergePeers(fetched, file.Peers()), nil
+}
+
+// WriteProbedPeers keeps the peers selected by a probe and regenerates
+// topology.json with them. It returns whether the topology changed.
+// topology.json is only regenerated from pool_layout, without it the
+// published topology would be replaced by the probed peers alone.
+func (c *Config) WriteProbedPeers(peers []topo.Peer) (bool, error) {
+	if err := c.CheckProbeWrite(); err != nil {
+		return false, err
+	}
+	data, err := json.MarshalIndent(peers, "", "  ")
+	if err != nil {
+		return false, errors.Annotate(err, "encoding probed peers")
+	}
+	if err = writeFile(bytes.NewReader(data), c.probedPeersFile()); err != nil {
+		return false, errors.Annotate(err, "saving probed peers")
+	}
+	return c.updateTopology()
+}
+
+// CheckProbeWrite tells whether probed peers can be added to the topology
+// of this node.
+func (c *Config) CheckProbeWrite() error {
+	if c.IsProducer {
+		return errors.New("a producer only connects to the pool's relays, probed peers are not added")
+	}
+	layout, err := PoolLayout()
+	if err != nil {
+		return err
+	}
+	if layout == nil {
+		return errors.New("probed peers are only added to a topology generated from pool_layout, " +
+			"add them to topology.json yourself")
+	}
+	return nil
+}
+
+// probedPeersFile keeps the peers selected by the last probe.
+func (c *Config) probedPeersFile() string {
+	return filepath.Join(c.CardanoBaseLocal, "config", probedPeersName)
+}
+
+// probedPeers returns the peers selected by the last probe, none on a
+// producer or without layout.
+func (c *Config) probedPeers(layout *topo.Layout) ([]topo.Peer, error) {
+	if c.IsProducer {
+		return nil, nil
+	}
+	peers, err := readPeers(c.probedPeersFile())
+	if err != nil || layout != nil || len(peers) == 0 {
+		return peers, err
+	}
+	logrus.Warnf("%s is ignored without pool_layout", c.probedPeersFile())
+	return nil, nil
+}
+
+// readPeers reads a list of peers saved by gocard, none when the file does
+// not exist.
+func readPeers(file string) ([]topo.Peer, error) {
+	peers := make([]topo.Peer, 0)
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return peers, nil
+	}
+	if err != nil {
+		return nil, errors.Annotatef(err, "reading %s", file)
+	}
+	if err = json.Unmarshal(data, &peers); err != nil {
+		return nil, errors.Annotatef(err, "parsing %s", file)
+	}
+	return peers, nil
+}
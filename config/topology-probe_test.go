@@ -0,0 +1,57 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+
+	topo "github.com/adakailabs/gocard/topology"
+)
+
+func TestWriteProbedPeersWithoutLayout(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+
+	c := &Config{CardanoBaseLocal: t.TempDir()}
+	configDir := filepath.Join(c.CardanoBaseLocal, "config")
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	published, err := bundles.ReadFile("bundles/preview/topology.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(c.TopologyFile(), published, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	probed := []topo.Peer{{Address: "relay.example.com", Port: 3001, Valency: 1}}
+	if _, err = c.WriteProbedPeers(probed); err == nil {
+		t.Error("expected --write to be refused without pool_layout")
+	}
+
+	// a probe file left from an earlier layout is not applied either
+	data, err := json.Marshal(probed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(c.probedPeersFile(), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := c.updateTopology(); err != nil || changed {
+		t.Errorf("topology changed %t: %v", changed, err)
+	}
+
+	current, err := ioutil.ReadFile(c.TopologyFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(current, published) {
+		t.Errorf("the published topology was replaced:\n%s", current)
+	}
+}
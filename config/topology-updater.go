@@ -0,0 +1,163 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	topo "github.com/adakailabs/gocard/topology"
+)
+
+const RestartNever = "never"
+const RestartOnChange = "on_change"
+
+const updaterPeersName = "topology-updater.json"
+const defaultUpdaterInterval = time.Hour
+const defaultUpdaterMaxPeers = 14
+
+// TopologyUpdater keeps a legacy relay listed by a topology updater service
+// and its topology filled with the relays the service returns.
+type TopologyUpdater struct {
+	Enabled     bool
+	Endpoint    string
+	Interval    time.Duration
+	Hostname    string
+	MaxPeers    int
+	IPVersion   int
+	CustomPeers []topo.Peer
+	// Restart is the restart policy of the node when the topology changes.
+	Restart string
+}
+
+func (c *Config) SetTopologyUpdater() {
+	u := TopologyUpdater{
+		Enabled:   viper.GetBool("topology_updater.enabled"),
+		Endpoint:  viper.GetString("topology_updater.endpoint"),
+		Interval:  viper.GetDuration("topology_updater.interval"),
+		Hostname:  viper.GetString("topology_updater.hostname"),
+		MaxPeers:  viper.GetInt("topology_updater.max_peers"),
+		IPVersion: viper.GetInt("topology_updater.ip_version"),
+		Restart:   viper.GetString("topology_updater.restart"),
+	}
+	if err := viper.UnmarshalKey("topology_updater.custom_peers", &u.CustomPeers); err != nil {
+		panic(errors.Annotate(err, "reading topology_updater.custom_peers").Error())
+	}
+
+	for i := range u.CustomPeers {
+		if u.CustomPeers[i].Valency == 0 {
+			u.CustomPeers[i].Valency = topo.DefaultValency
+		}
+	}
+	if u.Enabled && c.IsProducer {
+		logrus.Warn("topology_updater is for relays, it is disabled on the producer")
+		u.Enabled = false
+	}
+	if u.Endpoint == "" {
+		u.Endpoint = topo.DefaultUpdaterEndpoint
+	}
+	if u.Interval == 0 {
+		u.Interval = defaultUpdaterInterval
+	}
+	if u.MaxPeers == 0 {
+		u.MaxPeers = defaultUpdaterMaxPeers
+	}
+	if u.Restart == "" {
+		u.Restart = RestartOnChange
+	}
+
+	if err := u.check(); err != nil {
+		panic(errors.ErrorStack(err))
+	}
+	c.TopologyUpdater = u
+}
+
+func (u *TopologyUpdater) check() error {
+	if !u.Enabled {
+		return nil
+	}
+	if u.Restart != RestartNever && u.Restart != RestartOnChange {
+		return errors.Errorf("topology_updater.restart must be %s or %s, found: %s", RestartNever, RestartOnChange, u.Restart)
+	}
+	if u.IPVersion != 0 && u.IPVersion != 4 && u.IPVersion != 6 {
+		return errors.Errorf("topology_updater.ip_version must be 4 or 6, found: %d", u.IPVersion)
+	}
+	for i, peer := range u.CustomPeers {
+		if peer.Address == "" || peer.Port <= 0 || peer.Port > 65535 {
+			return errors.Errorf("topology_updater.custom_peers[%d]: address and a valid port are required", i)
+		}
+	}
+	layout, err := PoolLayout()
+	if err != nil {
+		return err
+	}
+	if layout != nil && layout.Format == topo.FormatP2P {
+		return errors.New("topology_updater only applies to legacy topologies, pool_layout.format is p2p")
+	}
+	return nil
+}
+
+// UpdatePeers registers the relay at blockNo, fetches the listed relays and
+// regenerates topology.json with them. It returns whether the topology
+// changed.
+func (c *Config) UpdatePeers(ctx context.Context, blockNo int64) (bool, error) {
+	u := c.TopologyUpdater
+	magic, err := c.networkMagic()
+	if err != nil {
+		return false, err
+	}
+	port, err := strconv.Atoi(c.CardanoPort)
+	if err != nil {
+		return false, errors.Annotatef(err, "cardano_port %q", c.CardanoPort)
+	}
+
+	updater := &topo.Updater{Endpoint: u.Endpoint, Client: &http.Client{Timeout: defaultDownloadTimeout}}
+	message, err := updater.Register(ctx, topo.Registration{
+		Port:     port,
+		BlockNo:  blockNo,
+		Valency:  topo.DefaultValency,
+		Magic:    magic,
+		Hostname: u.Hostname,
+	})
+	if err != nil {
+		return false, err
+	}
+	logrus.Infof("relay registered at block %d: %s", blockNo, message)
+
+	peers, err := updater.Fetch(ctx, u.MaxPeers, magic, u.IPVersion)
+	if err != nil {
+		return false, err
+	}
+	logrus.Infof("%d peer(s) fetched from %s", len(peers), u.Endpoint)
+
+	data, err := json.MarshalIndent(peers, "", "  ")
+	if err != nil {
+		return false, errors.Annotate(err, "encoding fetched peers")
+	}
+	if err = writeFile(bytes.NewReader(data), c.updaterPeersFile()); err != nil {
+		return false, errors.Annotate(err, "saving fetched peers")
+	}
+	return c.updateTopology()
+}
+
+// updaterPeersFile keeps the last fetched peers, so the topology can be
+// regenerated without asking the service again.
+func (c *Config) updaterPeersFile() string {
+	return filepath.Join(c.CardanoBaseLocal, "config", updaterPeersName)
+}
+
+// updaterPeers returns the custom peers followed by the last fetched ones.
+func (c *Config) updaterPeers() ([]topo.Peer, error) {
+	fetched, err := readPeers(c.updaterPeersFile())
+	if err != nil {
+		return nil, err
+	}
+	return topo.MergePeers(c.TopologyUpdater.CustomPeers, fetched), nil
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	topo "github.com/adakailabs/gocard/topology"
+)
+
+// PoolLayout returns the pool_layout section, nil when topology.json is not
+// generated.
+func PoolLayout() (*topo.Layout, error) {
+	if !viper.IsSet("pool_layout") {
+		return nil, nil
+	}
+	layout := &topo.Layout{}
+	if err := viper.UnmarshalKey("pool_layout", layout); err != nil {
+		return nil, errors.Annotate(err, "reading pool_layout")
+	}
+	if err := layout.Validate(); err != nil {
+		return nil, err
+	}
+	return layout, nil
+}
+
+// TopologyPeers returns the peers of this node in the pool layout. A relay
+// is found in pool_layout.relays by its server_name.
+func (c *Config) TopologyPeers(layout *topo.Layout) []topo.Peer {
+	self := viper.GetString("server_name")
+	if !c.IsProducer && !layout.HasRelay(self) {
+		logrus.Warnf("pool_layout.relays has no relay named %s, this relay is not left out of its own peers", self)
+	}
+	return layout.Peers(c.IsProducer, self)
+}
+
+// updateTopology generates topology.json from pool_layout, on a relay
+// using the topology updater from its custom and fetched peers, and on a
+// relay of the layout from the peers selected by "gocard topology probe". It
+// returns whether the file changed.
+func (c *Config) updateTopology() (bool, error) {
+	layout, err := PoolLayout()
+	if err != nil {
+		return false, err
+	}
+	probed, err := c.probedPeers(layout)
+	if err != nil {
+		return false, err
+	}
+	if layout == nil && !c.TopologyUpdater.Enabled {
+		return false, nil
+	}
+
+	var peers []topo.Peer
+	if layout != nil {
+		peers = c.TopologyPeers(layout)
+	}
+	if c.TopologyUpdater.Enabled {
+		updaterPeers, err := c.updaterPeers()
+		if err != nil {
+			return false, err
+		}
+		peers = topo.MergePeers(peers, updaterPeers)
+	}
+	peers = topo.MergePeers(peers, probed)
+
+	var generated interface{ Validate() error }
+	format := topo.FormatLegacy
+	if layout != nil && layout.Format == topo.FormatP2P {
+		format = topo.FormatP2P
+		p2p := topo.NewP2P(layout, c.IsProducer, viper.GetString("server_name"))
+		p2p.AddPublicRoots(probed)
+		generated = p2p
+	} else {
+		generated = topo.NewLegacy(peers)
+	}
+	if err = generated.Validate(); err != nil {
+		return false, errors.Annotate(err, "generated topology")
+	}
+	data, err := topo.Encode(generated)
+	if err != nil {
+		return false, err
+	}
+
+	topologyFile := fmt.Sprintf("%s/config/%s", c.CardanoBaseLocal, newTopology)
+	if current, err := ioutil.ReadFile(topologyFile); err == nil && bytes.Equal(current, data) {
+		logrus.Info("topology unchanged: ", topologyFile)
+		return false, nil
+	}
+	if err := writeFile(bytes.NewReader(data), topologyFile); err != nil {
+		return false, errors.Annotatef(err, "writing %s", topologyFile)
+	}
+	for _, peer := range peers {
+		logrus.Infof("topology peer: %s valency %d", peer, peer.Valency)
+	}
+	logrus.Infof("%s topology generated: %s", format, topologyFile)
+	return true, nil
+}
+
+// applyTopologyFormat enables P2P in the node configuration when the
+// generated topology is a P2P one, and disables it for a legacy one.
+func applyTopologyFormat(nodeConfig *NodeConfig) error {
+	layout, err := PoolLayout()
+	if err != nil || layout == nil {
+		return err
+	}
+	enabled := layout.Format == topo.FormatP2P
+	nodeConfig.EnableP2P = &enabled
+	return nil
+}
@@ -0,0 +1,185 @@
+package config
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const TracerPresetUpstream = "upstream"
+const TracerPresetMinimal = "minimal"
+
+// tracerPresets are the named sets of Trace* switches selectable with
+// cardano_tracers.preset. A preset only sets the tracers it lists, the
+// others keep the value of the published config.json.
+var tracerPresets = map[string]map[string]bool{
+	// relays follow block and transaction propagation closely
+	NodeTypeRelay: {
+		"TraceBlockFetchClient":      true,
+		"TraceBlockFetchDecisions":   false,
+		"TraceBlockFetchProtocol":    false,
+		"TraceBlockFetchServer":      true,
+		"TraceChainDb":               true,
+		"TraceChainSyncClient":       false,
+		"TraceChainSyncBlockServer":  false,
+		"TraceChainSyncHeaderServer": false,
+		"TraceDNSResolver":           true,
+		"TraceDNSSubscription":       true,
+		"TraceErrorPolicy":           true,
+		"TraceForge":                 false,
+		"TraceIpSubscription":        true,
+		"TraceLocalErrorPolicy":      true,
+		"TraceMempool":               true,
+		"TraceMux":                   false,
+		"TraceTxInbound":             false,
+		"TraceTxOutbound":            false,
+		"TraceTxSubmissionProtocol":  false,
+	},
+	// producers trace forging and leave out the expensive mempool tracer
+	NodeTypeProducer: {
+		"TraceBlockFetchClient":      false,
+		"TraceBlockFetchDecisions":   false,
+		"TraceBlockFetchProtocol":    false,
+		"TraceBlockFetchServer":      false,
+		"TraceChainDb":               true,
+		"TraceChainSyncClient":       false,
+		"TraceChainSyncBlockServer":  false,
+		"TraceChainSyncHeaderServer": false,
+		"TraceDNSResolver":           true,
+		"TraceDNSSubscription":       true,
+		"TraceErrorPolicy":           true,
+		"TraceForge":                 true,
+		"TraceForgeStateInfo":        true,
+		"TraceIpSubscription":        true,
+		"TraceLocalErrorPolicy":      true,
+		"TraceMempool":               false,
+		"TraceMux":                   false,
+		"TraceTxInbound":             false,
+		"TraceTxOutbound":            false,
+		"TraceTxSubmissionProtocol":  false,
+	},
+	// minimal keeps the chain database and the error tracers only
+	TracerPresetMinimal: {
+		"TraceBlockFetchClient":      false,
+		"TraceBlockFetchDecisions":   false,
+		"TraceBlockFetchProtocol":    false,
+		"TraceBlockFetchServer":      false,
+		"TraceChainDb":               true,
+		"TraceChainSyncClient":       false,
+		"TraceChainSyncBlockServer":  false,
+		"TraceChainSyncHeaderServer": false,
+		"TraceDNSResolver":           false,
+		"TraceDNSSubscription":       false,
+		"TraceErrorPolicy":           true,
+		"TraceForge":                 false,
+		"TraceIpSubscription":        false,
+		"TraceLocalErrorPolicy":      true,
+		"TraceMempool":               false,
+		"TraceMux":                   false,
+		"TraceTxInbound":             false,
+		"TraceTxOutbound":            false,
+		"TraceTxSubmissionProtocol":  false,
+	},
+	// upstream leaves the published tracers alone
+	TracerPresetUpstream: {},
+}
+
+// TracerPresets returns the names of the tracer presets.
+func TracerPresets() []string {
+	names := make([]string, 0, len(tracerPresets))
+	for name := range tracerPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// tracerPreset returns the name of the preset selected with
+// cardano_tracers.preset, the one of the node's role by default. upstream,
+// keeping the published tracers, has to be asked for.
+func (c *Config) tracerPreset() string {
+	if preset := viper.GetString("cardano_tracers.preset"); preset != "" {
+		return preset
+	}
+	if c.IsProducer {
+		return NodeTypeProducer
+	}
+	return NodeTypeRelay
+}
+
+// TracerSettings returns the Trace* switches gocard writes to config.json:
+// the preset, then cardano_tracers.overrides, then the overrides of the
+// node's role in cardano_tracers.relay or cardano_tracers.producer.
+// Tracer names are matched case insensitively against known, the tracers
+// found in config.json, as the configuration keys are lowercased.
+func (c *Config) TracerSettings(known map[string]bool) (map[string]bool, error) {
+	presetName := c.tracerPreset()
+	preset, ok := tracerPresets[presetName]
+	if !ok {
+		return nil, errors.Errorf("unknown cardano_tracers.preset %s, use one of: %s",
+			presetName, strings.Join(TracerPresets(), ", "))
+	}
+
+	names := make(map[string]string, len(known)+len(preset))
+	for name := range known {
+		names[strings.ToLower(name)] = name
+	}
+	settings := make(map[string]bool, len(preset))
+	for name, enabled := range preset {
+		names[strings.ToLower(name)] = name
+		settings[name] = enabled
+	}
+
+	role := NodeTypeRelay
+	if c.IsProducer {
+		role = NodeTypeProducer
+	}
+	for _, key := range []string{"cardano_tracers.overrides", "cardano_tracers." + role} {
+		for lowered, value := range viper.GetStringMap(key) {
+			name, ok := names[strings.ToLower(lowered)]
+			if !ok {
+				logrus.Warnf("%s.%s: unknown tracer, ignored", key, lowered)
+				continue
+			}
+			enabled, err := tracerSwitch(value)
+			if err != nil {
+				return nil, errors.Annotatef(err, "%s.%s", key, lowered)
+			}
+			settings[name] = enabled
+		}
+	}
+	return settings, nil
+}
+
+// tracerSwitch reads an override, a boolean or, as set from GOCARD_
+// environment variables, the string true or false.
+func tracerSwitch(value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+	}
+	return false, errors.Errorf("expected true or false, found %v", value)
+}
+
+// applyTracers writes the tracer settings to a node configuration.
+func (c *Config) applyTracers(nodeConfig *NodeConfig) error {
+	settings, err := c.TracerSettings(nodeConfig.Tracers)
+	if err != nil {
+		return err
+	}
+	for name, enabled := range settings {
+		nodeConfig.Tracers[name] = enabled
+	}
+	logrus.Infof("tracer preset %s applied, %d tracer(s) set", c.tracerPreset(), len(settings))
+	return nil
+}
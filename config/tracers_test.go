@@ -0,0 +1,32 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestTracerPreset(t *testing.T) {
+	defer viper.Reset()
+
+	tests := []struct {
+		name       string
+		preset     string
+		isProducer bool
+		want       string
+	}{
+		{"relay by default", "", false, NodeTypeRelay},
+		{"producer by default", "", true, NodeTypeProducer},
+		{"upstream when asked for", TracerPresetUpstream, true, TracerPresetUpstream},
+		{"explicit preset", TracerPresetMinimal, false, TracerPresetMinimal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			viper.Set("cardano_tracers.preset", tt.preset)
+			c := &Config{IsProducer: tt.isProducer}
+			if got := c.tracerPreset(); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
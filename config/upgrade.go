@@ -0,0 +1,491 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const backupDirName = "config-backups"
+const backupTimeFormat = "20060102-150405"
+const maxBackupsPerSecond = 100
+
+// backupAddedFile lists, in a backup, the files the upgrade that took it
+// added to the config dir, rollback removes them.
+const backupAddedFile = "gocard-added.json"
+
+// managedConfigKeys are the config.json keys gocard always rewrites itself,
+// they are left out of upstream comparisons along with the preset tracers.
+var managedConfigKeys = []string{
+	"defaultScribes",
+	"setupScribes",
+	"rotation",
+	"hasPrometheus",
+}
+
+// JSONChange is one difference between two JSON documents.
+type JSONChange struct {
+	Path   string
+	Before interface{}
+	After  interface{}
+}
+
+func (jc JSONChange) String() string {
+	switch {
+	case jc.Before == nil:
+		return fmt.Sprintf("+ %s: %s", jc.Path, compactJSON(jc.After))
+	case jc.After == nil:
+		return fmt.Sprintf("- %s: %s", jc.Path, compactJSON(jc.Before))
+	default:
+		return fmt.Sprintf("~ %s: %s -> %s", jc.Path, compactJSON(jc.Before), compactJSON(jc.After))
+	}
+}
+
+// FileDiff holds the changes of one configuration file.
+type FileDiff struct {
+	Name    string
+	Missing bool
+	// Generated is set for the files gocard generates, they are not compared.
+	Generated bool
+	Changes   []JSONChange
+}
+
+// FetchUpstream writes the published configuration set, under the local
+// file names, to a new temporary directory. When fromDir is given the files
+// are read from it, named as they are published, instead of the configured
+// source.
+func (c *Config) FetchUpstream(fromDir string) (string, error) {
+	if c.IsPrivateNetwork() {
+		return "", errors.New("private networks have no upstream configuration")
+	}
+
+	var source ConfigSource = &dirSource{dir: fromDir}
+	if fromDir == "" {
+		var err error
+		if source, err = c.ConfigSource(); err != nil {
+			return "", err
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "gocard-upstream-")
+	if err != nil {
+		return "", errors.Annotate(err, "creating upstream dir")
+	}
+	if err = fetchConfigSet(source, dir, false); err != nil {
+		os.RemoveAll(dir)
+		return "", errors.Annotate(err, "fetching upstream")
+	}
+	return dir, nil
+}
+
+// DiffUpstream compares the local configuration files with the ones in
+// upstreamDir, ignoring the settings gocard manages in config.json.
+func (c *Config) DiffUpstream(upstreamDir string) ([]FileDiff, error) {
+	configPath := fmt.Sprintf("%s/config", c.CardanoBaseLocal)
+
+	names, err := upstreamFileNames(upstreamDir)
+	if err != nil {
+		return nil, err
+	}
+	layout, err := PoolLayout()
+	if err != nil {
+		return nil, err
+	}
+
+	diffs := make([]FileDiff, 0, len(names))
+	for _, name := range names {
+		if name == newTopology && (layout != nil || c.TopologyUpdater.Enabled) {
+			diffs = append(diffs, FileDiff{Name: name, Generated: true})
+			continue
+		}
+
+		upstream, err := ioutil.ReadFile(filepath.Join(upstreamDir, name))
+		if err != nil {
+			return nil, errors.Annotatef(err, "reading upstream %s", name)
+		}
+
+		local, err := ioutil.ReadFile(filepath.Join(configPath, name))
+		if os.IsNotExist(err) {
+			diffs = append(diffs, FileDiff{Name: name, Missing: true})
+			continue
+		}
+		if err != nil {
+			return nil, errors.Annotatef(err, "reading %s", name)
+		}
+
+		var ignore []string
+		if name == newConfig {
+			nodeConfig, err := ParseNodeConfig(upstream)
+			if err != nil {
+				return nil, errors.Annotatef(err, "parsing upstream %s", name)
+			}
+			ignore = c.managedConfigKeys(nodeConfig)
+		}
+		changes, err := DiffJSON(local, upstream, ignore)
+		if err != nil {
+			return nil, errors.Annotatef(err, "comparing %s", name)
+		}
+		diffs = append(diffs, FileDiff{Name: name, Changes: changes})
+	}
+	return diffs, nil
+}
+
+// upstreamFileNames lists the files of the configuration set fetched to
+// upstreamDir, genesis files included.
+func upstreamFileNames(upstreamDir string) ([]string, error) {
+	names := make([]string, 0, len(cardanoConfigFiles)+4)
+	for _, newName := range cardanoConfigFiles {
+		names = append(names, newName)
+	}
+	refs, err := readGenesisRefs(filepath.Join(upstreamDir, newConfig))
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range refs {
+		if !filepath.IsAbs(ref.file) {
+			names = append(names, ref.file)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// WriteDiffs prints diffs in a readable form.
+func WriteDiffs(w io.Writer, diffs []FileDiff) {
+	for _, diff := range diffs {
+		switch {
+		case diff.Generated:
+			fmt.Fprintf(w, "%s: generated by gocard, not compared\n", diff.Name)
+		case diff.Missing:
+			fmt.Fprintf(w, "%s: missing locally\n", diff.Name)
+		case len(diff.Changes) == 0:
+			fmt.Fprintf(w, "%s: up to date\n", diff.Name)
+		default:
+			fmt.Fprintf(w, "%s: %d change(s)\n", diff.Name, len(diff.Changes))
+			for _, change := range diff.Changes {
+				fmt.Fprintln(w, "  ", change)
+			}
+		}
+	}
+}
+
+// DiffJSON returns the changes needed to turn before into after. Top level
+// keys listed in ignore are not compared.
+func DiffJSON(before, after []byte, ignore []string) ([]JSONChange, error) {
+	var a, b interface{}
+	if err := json.Unmarshal(before, &a); err != nil {
+		return nil, errors.Annotate(err, "parsing local json")
+	}
+	if err := json.Unmarshal(after, &b); err != nil {
+		return nil, errors.Annotate(err, "parsing upstream json")
+	}
+
+	if am, ok := a.(map[string]interface{}); ok {
+		if bm, ok := b.(map[string]interface{}); ok {
+			for _, key := range ignore {
+				delete(am, key)
+				delete(bm, key)
+			}
+		}
+	}
+
+	changes := make([]JSONChange, 0)
+	diffValues("", a, b, &changes)
+	return changes, nil
+}
+
+func diffValues(path string, a, b interface{}, changes *[]JSONChange) {
+	am, aIsMap := a.(map[string]interface{})
+	bm, bIsMap := b.(map[string]interface{})
+	if aIsMap && bIsMap {
+		keys := make([]string, 0, len(am)+len(bm))
+		for key := range am {
+			keys = append(keys, key)
+		}
+		for key := range bm {
+			if _, ok := am[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			diffValues(joinPath(path, key), am[key], bm[key], changes)
+		}
+		return
+	}
+
+	aList, aIsList := a.([]interface{})
+	bList, bIsList := b.([]interface{})
+	if aIsList && bIsList && len(aList) == len(bList) {
+		for i := range aList {
+			diffValues(fmt.Sprintf("%s[%d]", path, i), aList[i], bList[i], changes)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(a, b) {
+		if path == "" {
+			path = "."
+		}
+		*changes = append(*changes, JSONChange{Path: path, Before: a, After: b})
+	}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func compactJSON(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	const maxLen = 120
+	if len(data) > maxLen {
+		return string(data[:maxLen]) + "..."
+	}
+	return string(data)
+}
+
+// UpgradeConfig backs up the local configuration files, replaces them with
+// the ones in upstreamDir and re-applies the gocard settings. When the
+// result fails verification the backup is restored. It returns the name of
+// the backup.
+func (c *Config) UpgradeConfig(upstreamDir string) (string, error) {
+	backup, err := c.BackupConfig()
+	if err != nil {
+		return "", err
+	}
+
+	names, err := upstreamFileNames(upstreamDir)
+	if err != nil {
+		return backup, err
+	}
+
+	configPath := fmt.Sprintf("%s/config", c.CardanoBaseLocal)
+	if err = c.recordAddedFiles(backup, names); err != nil {
+		return backup, err
+	}
+	for _, name := range names {
+		if err = copyIntoPlace(filepath.Join(upstreamDir, name), filepath.Join(configPath, name)); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = c.updateCardanoConfig()
+	}
+	if err == nil {
+		_, err = c.updateTopology()
+	}
+	if err == nil {
+		err = c.VerifyGenesisHashes()
+	}
+
+	if err != nil {
+		logrus.Error("upgrade failed, restoring backup ", backup)
+		if errR := c.RollbackConfig(backup); errR != nil {
+			return backup, errors.Annotatef(errR, "restoring backup after: %s", err.Error())
+		}
+		return backup, errors.Annotate(err, "upgrading config")
+	}
+	return backup, nil
+}
+
+// BackupConfig copies the configuration files to a new timestamped backup
+// and returns its name.
+func (c *Config) BackupConfig() (string, error) {
+	configPath := fmt.Sprintf("%s/config", c.CardanoBaseLocal)
+	name, err := c.newBackupDir(time.Now())
+	if err != nil {
+		return "", err
+	}
+	backupPath := filepath.Join(c.backupDir(), name)
+
+	for _, fileName := range c.cardanoConfigFileNames() {
+		source := filepath.Join(configPath, fileName)
+		if _, err := os.Stat(source); os.IsNotExist(err) {
+			continue
+		}
+		if err := copyIntoPlace(source, filepath.Join(backupPath, fileName)); err != nil {
+			return "", errors.Annotate(err, "backing up config")
+		}
+	}
+	logrus.Info("config backed up to: ", backupPath)
+	return name, nil
+}
+
+// recordAddedFiles writes to backup the names that are not in the config
+// dir yet.
+func (c *Config) recordAddedFiles(backup string, names []string) error {
+	configPath := fmt.Sprintf("%s/config", c.CardanoBaseLocal)
+	added := make([]string, 0)
+	for _, name := range names {
+		if _, err := os.Stat(filepath.Join(configPath, name)); os.IsNotExist(err) {
+			added = append(added, name)
+		}
+	}
+	data, err := json.Marshal(added)
+	if err != nil {
+		return errors.Annotate(err, "encoding added files")
+	}
+	target := filepath.Join(c.backupDir(), backup, backupAddedFile)
+	if err = writeFile(bytes.NewReader(data), target); err != nil {
+		return errors.Annotatef(err, "writing %s", target)
+	}
+	return nil
+}
+
+// RollbackConfig restores the files of backup, the latest one when empty,
+// removes the files added by the upgrade that took it and verifies the
+// genesis hashes of the result.
+func (c *Config) RollbackConfig(backup string) error {
+	if backup == "" {
+		backups, err := c.ConfigBackups()
+		if err != nil {
+			return err
+		}
+		if len(backups) == 0 {
+			return errors.New("no config backups found")
+		}
+		backup = backups[len(backups)-1]
+	}
+	if backup == "." || backup == ".." || strings.ContainsAny(backup, `/\`) {
+		return errors.Errorf("invalid backup name %s, see gocard node config backups", backup)
+	}
+
+	backupPath := filepath.Join(c.backupDir(), backup)
+	if info, err := os.Stat(backupPath); err != nil || !info.IsDir() {
+		return errors.Errorf("backup %s not found in %s", backup, c.backupDir())
+	}
+
+	configPath := fmt.Sprintf("%s/config", c.CardanoBaseLocal)
+	added, err := readAddedFiles(backupPath)
+	if err != nil {
+		return errors.Annotatef(err, "reading backup %s", backup)
+	}
+	for _, name := range added {
+		if err := os.Remove(filepath.Join(configPath, name)); err != nil && !os.IsNotExist(err) {
+			return errors.Annotatef(err, "removing %s added by the upgrade", name)
+		}
+		logrus.Info("removed file added by the upgrade: ", name)
+	}
+
+	err = filepath.Walk(backupPath, func(source string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		name, err := filepath.Rel(backupPath, source)
+		if err != nil || name == backupAddedFile {
+			return err
+		}
+		return copyIntoPlace(source, filepath.Join(configPath, name))
+	})
+	if err != nil {
+		return errors.Annotatef(err, "restoring backup %s", backup)
+	}
+	logrus.Info("config restored from: ", backupPath)
+
+	if err = c.VerifyGenesisHashes(); err != nil {
+		return errors.Annotatef(err, "restored backup %s", backup)
+	}
+	return nil
+}
+
+// readAddedFiles returns the files recorded by recordAddedFiles, none for
+// backups not taken by an upgrade.
+func readAddedFiles(backupPath string) ([]string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(backupPath, backupAddedFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var added []string
+	if err = json.Unmarshal(data, &added); err != nil {
+		return nil, errors.Annotatef(err, "parsing %s", backupAddedFile)
+	}
+	for _, name := range added {
+		if clean := filepath.Clean(name); filepath.IsAbs(clean) || clean == ".." ||
+			strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+			return nil, errors.Errorf("%s lists %s, outside the config dir", backupAddedFile, name)
+		}
+	}
+	return added, nil
+}
+
+// ConfigBackups lists the backup names, oldest first.
+func (c *Config) ConfigBackups() ([]string, error) {
+	entries, err := ioutil.ReadDir(c.backupDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Annotate(err, "listing config backups")
+	}
+
+	backups := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			backups = append(backups, entry.Name())
+		}
+	}
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// newBackupDir creates the directory of a backup taken at t and returns its
+// name. Backups taken within the same second get a sequence suffix so they
+// still sort oldest first.
+func (c *Config) newBackupDir(t time.Time) (string, error) {
+	if err := os.MkdirAll(c.backupDir(), os.ModePerm); err != nil {
+		return "", errors.Annotatef(err, "creating dir: %s", c.backupDir())
+	}
+	base := t.Format(backupTimeFormat)
+	name := base
+	for i := 1; i < maxBackupsPerSecond; i++ {
+		err := os.Mkdir(filepath.Join(c.backupDir(), name), os.ModePerm)
+		if err == nil {
+			return name, nil
+		}
+		if !os.IsExist(err) {
+			return "", errors.Annotatef(err, "creating dir: %s", name)
+		}
+		name = fmt.Sprintf("%s-%02d", base, i)
+	}
+	return "", errors.Errorf("too many config backups at %s", base)
+}
+
+func (c *Config) backupDir() string {
+	return filepath.Join(c.CardanoBaseLocal, backupDirName)
+}
+
+func copyIntoPlace(source, target string) error {
+	data, err := ioutil.ReadFile(source)
+	if err != nil {
+		return errors.Annotatef(err, "reading %s", source)
+	}
+	if err = os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return errors.Annotatef(err, "creating dir: %s", filepath.Dir(target))
+	}
+	return writeFile(bytes.NewReader(data), target)
+}
+
+// ManagedConfigKeys returns the config.json keys gocard rewrites.
+func ManagedConfigKeys() []string {
+	return append([]string{}, managedConfigKeys...)
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// previewConfigDir fetches the preview bundle into the config dir of c.
+func previewConfigDir(t *testing.T, c *Config) string {
+	dir := filepath.Join(c.CardanoBaseLocal, "config")
+	if err := fetchConfigSet(newEmbeddedSource(NetworkPreview), dir, false); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestRollbackConfig(t *testing.T) {
+	upstream := previewConfigDir(t, &Config{CardanoBaseLocal: t.TempDir()})
+
+	// the local set predates the conway era
+	c := &Config{CardanoBaseLocal: t.TempDir()}
+	configDir := previewConfigDir(t, c)
+	data, err := ioutil.ReadFile(filepath.Join(configDir, newConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodeConfig := map[string]interface{}{}
+	if err = json.Unmarshal(data, &nodeConfig); err != nil {
+		t.Fatal(err)
+	}
+	delete(nodeConfig, "ConwayGenesisFile")
+	delete(nodeConfig, "ConwayGenesisHash")
+	if data, err = json.Marshal(nodeConfig); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(configDir, newConfig), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	conway := filepath.Join(configDir, "conway-genesis.json")
+	if err = os.Remove(conway); err != nil {
+		t.Fatal(err)
+	}
+
+	// upgrade as UpgradeConfig does, without the gocard settings
+	backup, err := c.BackupConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := upstreamFileNames(upstream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.recordAddedFiles(backup, names); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		if err = copyIntoPlace(filepath.Join(upstream, name), filepath.Join(configDir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = c.RollbackConfig(backup); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(conway); !os.IsNotExist(err) {
+		t.Error("the conway genesis added by the upgrade is still there")
+	}
+	restored, err := ioutil.ReadFile(filepath.Join(configDir, newConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(restored, data) {
+		t.Error("config.json was not restored")
+	}
+	if _, err = os.Stat(filepath.Join(configDir, backupAddedFile)); !os.IsNotExist(err) {
+		t.Errorf("%s was copied into the config dir", backupAddedFile)
+	}
+
+	for _, name := range []string{"..", ".", "../" + backup, backup + "/..", `..\` + backup, "missing"} {
+		if err = c.RollbackConfig(name); err == nil {
+			t.Errorf("backup %q accepted", name)
+		}
+	}
+
+	byron := filepath.Join(c.backupDir(), backup, "byron-genesis.json")
+	if err = ioutil.WriteFile(byron, []byte(`{"tampered": true}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.RollbackConfig(backup); err == nil {
+		t.Error("a backup failing the genesis hashes was restored without an error")
+	}
+}
@@ -0,0 +1,166 @@
+package node
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/adakailabs/gocard/config"
+)
+
+// Tip is the output of cardano-cli query tip.
+type Tip struct {
+	Block        int64  `json:"block"`
+	Epoch        int64  `json:"epoch"`
+	Slot         int64  `json:"slot"`
+	Era          string `json:"era"`
+	Hash         string `json:"hash"`
+	SyncProgress string `json:"syncProgress"`
+}
+
+// Exec runs cmd in a running container and returns its standard output. A
+// non zero exit code is an error carrying the standard error.
+func Exec(ctx context.Context, cli *client.Client, containerID string, cmd []string, env []string) ([]byte, error) {
+	exec, err := cli.ContainerExecCreate(ctx, containerID, types.ExecConfig{
+		Cmd:          cmd,
+		Env:          env,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return nil, errors.Annotatef(err, "creating exec of %s", cmd[0])
+	}
+
+	resp, err := cli.ContainerExecAttach(ctx, exec.ID, types.ExecStartCheck{})
+	if err != nil {
+		return nil, errors.Annotatef(err, "attaching to exec of %s", cmd[0])
+	}
+	defer resp.Close()
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	if _, err = stdcopy.StdCopy(stdout, stderr, resp.Reader); err != nil {
+		return nil, errors.Annotatef(err, "reading output of %s", cmd[0])
+	}
+
+	inspect, err := cli.ContainerExecInspect(ctx, exec.ID)
+	if err != nil {
+		return nil, errors.Annotatef(err, "inspecting exec of %s", cmd[0])
+	}
+	if inspect.ExitCode != 0 {
+		return nil, errors.Errorf("%s exited with code %d: %s",
+			strings.Join(cmd, " "), inspect.ExitCode, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// CardanoCli runs cardano-cli in the node container, connected to the node
+// socket.
+func CardanoCli(ctx context.Context, cli *client.Client, c *config.Config, containerID string, args ...string) ([]byte, error) {
+	cmd := append([]string{c.CardanoCli}, args...)
+	env := []string{"CARDANO_NODE_SOCKET_PATH=" + c.SocketPath()}
+	return Exec(ctx, cli, containerID, cmd, env)
+}
+
+// QueryTip returns the tip of the node running in containerID.
+func QueryTip(ctx context.Context, cli *client.Client, c *config.Config, containerID string) (*Tip, error) {
+	networkArgs, err := c.NetworkArgs()
+	if err != nil {
+		return nil, err
+	}
+	out, err := CardanoCli(ctx, cli, c, containerID, append([]string{"query", "tip"}, networkArgs...)...)
+	if err != nil {
+		return nil, errors.Annotate(err, "querying tip")
+	}
+
+	tip := &Tip{}
+	if err = json.Unmarshal(out, tip); err != nil {
+		return nil, errors.Annotate(err, "parsing tip")
+	}
+	return tip, nil
+}
+
+// QueryProtocolState returns the output of cardano-cli query protocol-state
+// of the node running in containerID.
+func QueryProtocolState(ctx context.Context, cli *client.Client, c *config.Config, containerID string) ([]byte, error) {
+	networkArgs, err := c.NetworkArgs()
+	if err != nil {
+		return nil, err
+	}
+	out, err := CardanoCli(ctx, cli, c, containerID, append([]string{"query", "protocol-state"}, networkArgs...)...)
+	if err != nil {
+		return nil, errors.Annotate(err, "querying protocol state")
+	}
+	return out, nil
+}
+
+// ContainerCli runs cardano-cli and other commands in a container.
+type ContainerCli struct {
+	cli         *client.Client
+	c           *config.Config
+	ContainerID string
+	// scratch is set for a throwaway container, removed by Close.
+	scratch bool
+}
+
+// NewContainerCli runs commands in a throwaway container of docker_image
+// without network, or when nodeContainer is set in the running node
+// container. Close removes the throwaway container.
+func NewContainerCli(ctx context.Context, cli *client.Client, c *config.Config, nodeContainer bool) (*ContainerCli, error) {
+	if nodeContainer {
+		if !c.ContainerIsUP {
+			return nil, errors.New("the node container is not running")
+		}
+		logrus.Info("running cardano-cli in the node container: ", c.ContainerID)
+		return &ContainerCli{cli: cli, c: c, ContainerID: c.ContainerID}, nil
+	}
+	containerID, err := startScratch(ctx, cli, c)
+	if err != nil {
+		return nil, err
+	}
+	logrus.Info("running cardano-cli in a throwaway container: ", containerID)
+	return &ContainerCli{cli: cli, c: c, ContainerID: containerID, scratch: true}, nil
+}
+
+func (r *ContainerCli) CardanoCli(ctx context.Context, args ...string) ([]byte, error) {
+	return CardanoCli(ctx, r.cli, r.c, r.ContainerID, args...)
+}
+
+func (r *ContainerCli) Exec(ctx context.Context, cmd ...string) ([]byte, error) {
+	return Exec(ctx, r.cli, r.ContainerID, cmd, nil)
+}
+
+// Close removes the throwaway container, the node container is left alone.
+func (r *ContainerCli) Close(ctx context.Context) error {
+	if !r.scratch {
+		return nil
+	}
+	return removeContainerNamed(ctx, r.cli, scratchName(r.c), "throwaway")
+}
+
+// WriteFile copies data to file in the container, owned by the user the
+// container runs as.
+func (r *ContainerCli) WriteFile(ctx context.Context, file string, data []byte, mode os.FileMode) error {
+	archive := &bytes.Buffer{}
+	tw := tar.NewWriter(archive)
+	if err := tw.WriteHeader(&tar.Header{Name: path.Base(file), Mode: int64(mode.Perm()), Size: int64(len(data))}); err != nil {
+		return errors.Annotatef(err, "archiving %s", file)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return errors.Annotatef(err, "archiving %s", file)
+	}
+	if err := tw.Close(); err != nil {
+		return errors.Annotatef(err, "archiving %s", file)
+	}
+	err := r.cli.CopyToContainer(ctx, r.ContainerID, path.Dir(file), archive, types.CopyToContainerOptions{CopyUIDGID: true})
+	return errors.Annotatef(err, "copying %s to the container", file)
+}
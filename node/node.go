@@ -8,10 +8,9 @@ import (
 	"os"
 	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
-	"github.com/docker/docker/api/types/container"
-
 	"github.com/coreos/go-systemd/daemon"
 
 	"github.com/juju/errors"
@@ -19,13 +18,14 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/adakailabs/gocard/config"
+	"github.com/adakailabs/gocard/topology"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/client"
 )
 
 func Start(c *config.Config) {
-	if err := c.CheckCardanoConfigFiles(); err != nil {
+	if err := preflight(c); err != nil {
 		logrus.Fatal(errors.ErrorStack(err))
 	}
 
@@ -34,21 +34,90 @@ func Start(c *config.Config) {
 		return
 	}
 
-	dockerImage := c.DockerImage
-
 	ctx := context.Background()
 	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
 	if err != nil {
 		panic(err)
 	}
 
-	reader, err := cli.ImagePull(ctx, dockerImage, types.ImagePullOptions{})
+	if c.CardanoTracer.Enabled {
+		if _, err = startTracer(ctx, cli, c); err != nil {
+			panic(err)
+		}
+	}
+
+	containerID, err := startContainer(ctx, cli, c)
 	if err != nil {
 		panic(err)
 	}
+
+	// setup signal catching
+	sigs := make(chan os.Signal, 1)
+
+	// catch all signals since not explicitly listing
+	signal.Notify(sigs)
+
+	writeContainerID(containerID)
+	readStartupLogsAndNotify(ctx, cli, containerID)
+
+	r := &runner{
+		ctx:         ctx,
+		cli:         cli,
+		c:           c,
+		containerID: containerID,
+		settings:    config.Settings(),
+	}
+	r.containerWait(sigs)
+}
+
+// preflight runs the checks a configuration must pass before a node
+// container is started with it.
+func preflight(c *config.Config) error {
+	if err := c.CheckCardanoConfigFiles(); err != nil {
+		return err
+	}
+	if err := c.VerifyGenesisHashes(); err != nil {
+		return err
+	}
+	if err := c.CheckPortCollisions(); err != nil {
+		return err
+	}
+	if err := checkTopology(c); err != nil {
+		return err
+	}
+	if c.IsProducer {
+		return c.CheckProducerKeys()
+	}
+	return nil
+}
+
+// checkTopology checks topology.json before the node starts: warnings are
+// logged, errors stop the start.
+func checkTopology(c *config.Config) error {
+	issues, err := c.CheckTopology(context.Background(), "")
+	if err != nil {
+		return err
+	}
+	for _, issue := range issues {
+		if issue.Severity == topology.SeverityError {
+			logrus.Errorf("topology: %s: %s", issue.Where, issue.Message)
+		} else {
+			logrus.Warnf("topology: %s: %s", issue.Where, issue.Message)
+		}
+	}
+	if topology.HasErrors(issues) {
+		return errors.New("topology check failed, run gocard topology check for details")
+	}
+	return nil
+}
+
+func startContainer(ctx context.Context, cli *client.Client, c *config.Config) (string, error) {
+	reader, err := cli.ImagePull(ctx, c.DockerImage, types.ImagePullOptions{})
+	if err != nil {
+		return "", err
+	}
 	if _, err = io.Copy(os.Stdout, reader); err != nil {
-		err = errors.Annotate(err, "copying to stadout")
-		panic(err.Error())
+		return "", errors.Annotate(err, "copying to stadout")
 	}
 
 	resp, err := cli.ContainerCreate(ctx,
@@ -56,31 +125,37 @@ func Start(c *config.Config) {
 		c.HostConfig,
 		nil, nil, "")
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 
 	if err = cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
-		panic(err)
+		return "", err
 	}
 
-	// setup signal catching
-	sigs := make(chan os.Signal, 1)
-
-	// catch all signals since not explicitly listing
-	signal.Notify(sigs)
-
-	writeContainerID(resp.ID)
-	readStartupLogsAndNotify(ctx, cli, resp.ID)
-	containerWait(ctx, cli, resp.ID, sigs)
+	return resp.ID, nil
 }
 
-func containerWait(ctx context.Context, cli *client.Client, containerID string, sigs chan os.Signal) {
-	statusCh, errCh := cli.ContainerWait(ctx, containerID, container.WaitConditionNotRunning)
+func (r *runner) containerWait(sigs chan os.Signal) {
+	reloads, err := config.WatchLayers()
+	if err != nil {
+		logrus.Error("config changes will not be applied: ", err.Error())
+	}
+
+	statusCh, errCh := r.wait()
+	var updates <-chan time.Time
+	refreshUpdates := func() {
+		var started bool
+		if updates, started = r.updaterTicks(); started && r.updateTopology() {
+			statusCh, errCh = r.wait()
+		}
+	}
+	refreshUpdates()
 	for {
 		select {
 		case err := <-errCh:
 			if err != nil {
 				logrus.Error("container stoped with error: ", err.Error())
+				stopTracer(r.c)
 				err = os.Remove(config.GocardPidFile)
 				if err != nil {
 					logrus.Error("could not remove pid file")
@@ -89,6 +164,7 @@ func containerWait(ctx context.Context, cli *client.Client, containerID string,
 			}
 		case this := <-statusCh:
 			logrus.Info("container stoped with with status: ", this.StatusCode)
+			stopTracer(r.c)
 			err := os.Remove(config.GocardPidFile)
 			if err != nil {
 				logrus.Error("could not remove pid file")
@@ -96,11 +172,34 @@ func containerWait(ctx context.Context, cli *client.Client, containerID string,
 			logrus.Info("stopping now")
 			logrus.Exit(int(this.StatusCode))
 
+		case <-reloads:
+			if r.reload("config file changed") {
+				statusCh, errCh = r.wait()
+			}
+			refreshUpdates()
+
+		case <-updates:
+			if r.updateTopology() {
+				statusCh, errCh = r.wait()
+			}
+
+		case <-r.updaterRetry:
+			if r.updateTopology() {
+				statusCh, errCh = r.wait()
+			}
+
 		case s := <-sigs:
 			logrus.Tracef("RECEIVED SIGNAL: %s", s.String())
+			if s == syscall.SIGHUP {
+				if r.reload("received SIGHUP") {
+					statusCh, errCh = r.wait()
+				}
+				refreshUpdates()
+			}
 			if s.String() == "terminated" || s.String() == "interrupt" {
 				logrus.Info("exiting with signal: ", s.String())
-				stop(containerID)
+				stop(r.containerID)
+				stopTracer(r.c)
 				logrus.Exit(0)
 			}
 		}
@@ -168,6 +267,7 @@ func Stop(c *config.Config) {
 	if c.ContainerIsUP {
 		stop(c.ContainerID)
 	}
+	stopTracer(c)
 }
 
 func stop(containerID string) {
@@ -0,0 +1,179 @@
+package node
+
+import (
+	"context"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/adakailabs/gocard/config"
+)
+
+// runner keeps the state of a node started by Start so configuration
+// changes can be applied to it while it runs.
+type runner struct {
+	ctx         context.Context
+	cli         *client.Client
+	c           *config.Config
+	containerID string
+	settings    map[string]interface{}
+	cancelWait  context.CancelFunc
+
+	updaterTicker   *time.Ticker
+	updaterInterval time.Duration
+	updaterRetry    <-chan time.Time
+	updaterBackoff  time.Duration
+}
+
+// wait (re)starts waiting for the current container to stop. Any previous
+// wait is cancelled so restarting or replacing a container on purpose does
+// not look like the node went down.
+func (r *runner) wait() (<-chan container.ContainerWaitOKBody, <-chan error) {
+	if r.cancelWait != nil {
+		r.cancelWait()
+	}
+	var waitCtx context.Context
+	waitCtx, r.cancelWait = context.WithCancel(r.ctx)
+	return r.cli.ContainerWait(waitCtx, r.containerID, container.WaitConditionNotRunning)
+}
+
+// reload reads the configuration again and applies the changes found since
+// the last load. It returns true when the container was restarted or
+// replaced and has to be waited on again. A configuration that cannot be
+// loaded or applied is logged and the current one is kept.
+func (r *runner) reload(reason string) bool {
+	logrus.Info("reloading configuration: ", reason)
+	if err := config.Reload(); err != nil {
+		logrus.Error("could not reload configuration, keeping the current one: ", errors.ErrorStack(err))
+		config.RestoreSettings(r.settings)
+		return false
+	}
+
+	settings := config.Settings()
+	changes := config.ClassifyChanges(r.settings, settings)
+	if len(changes) == 0 {
+		logrus.Info("configuration unchanged")
+		return false
+	}
+	config.LogChanges(changes)
+
+	class := config.MaxChangeClass(changes)
+	if class == config.ChangeLive {
+		r.settings = settings
+		logrus.Info("configuration changes applied")
+		return false
+	}
+
+	c, err := loadConfig()
+	if err != nil {
+		logrus.Error("invalid configuration, keeping the current one: ", errors.ErrorStack(err))
+		r.keepCurrent()
+		return false
+	}
+
+	var waited bool
+	if class == config.ChangeRestart {
+		waited, err = r.restart()
+	} else {
+		waited, err = r.recreate(c)
+	}
+	if err != nil {
+		logrus.Error("could not apply configuration, keeping the current one: ", errors.ErrorStack(err))
+		r.keepCurrent()
+		return waited
+	}
+	r.c = c
+	r.settings = settings
+	return waited
+}
+
+// keepCurrent puts the current configuration back after a reload failed,
+// with the node configuration files it generates.
+func (r *runner) keepCurrent() {
+	config.RestoreSettings(r.settings)
+	if err := r.c.RefreshNodeConfig(); err != nil {
+		logrus.Error("could not restore node configuration files: ", errors.ErrorStack(err))
+	}
+}
+
+// loadConfig builds the reloaded configuration, refreshes the node
+// configuration files with it and runs the checks of Start.
+func loadConfig() (*config.Config, error) {
+	c, err := config.Build()
+	if err != nil {
+		return nil, err
+	}
+	if err = c.RefreshNodeConfig(); err != nil {
+		return nil, err
+	}
+	if err = preflight(c); err != nil {
+		return nil, err
+	}
+	c.LogConfig()
+	return c, nil
+}
+
+// restart restarts the container so it reads its refreshed configuration
+// files. It returns whether the wait on the container was cancelled.
+func (r *runner) restart() (bool, error) {
+	r.cancelWait()
+	logrus.Info("restarting container with ID: ", r.containerID)
+	if err := r.cli.ContainerRestart(r.ctx, r.containerID, nil); err != nil {
+		return true, errors.Annotate(err, "restarting container")
+	}
+	return true, nil
+}
+
+// recreate replaces the container with one created from c. The old one is
+// stopped first, as the new one binds the same ports, and is started again
+// when the new one cannot be. It returns whether the wait on the container
+// was cancelled.
+func (r *runner) recreate(c *config.Config) (bool, error) {
+	r.cancelWait()
+	logrus.Info("replacing container with ID: ", r.containerID)
+	if err := r.cli.ContainerStop(r.ctx, r.containerID, nil); err != nil {
+		return true, errors.Annotate(err, "stopping container")
+	}
+
+	containerID, err := r.startReplacement(c)
+	if err != nil {
+		logrus.Error("starting the old container again: ", r.containerID)
+		if r.c.CardanoTracer.Enabled {
+			if _, errT := startTracer(r.ctx, r.cli, r.c); errT != nil {
+				logrus.Error("could not start cardano-tracer: ", errors.ErrorStack(errT))
+			}
+		}
+		if errS := r.cli.ContainerStart(r.ctx, r.containerID, types.ContainerStartOptions{}); errS != nil {
+			return true, errors.Annotatef(errS, "starting the old container after: %s", err.Error())
+		}
+		return true, err
+	}
+
+	if err := r.cli.ContainerRemove(r.ctx, r.containerID, types.ContainerRemoveOptions{}); err != nil {
+		logrus.Warn("could not remove old container: ", err.Error())
+	}
+	r.containerID = containerID
+	writeContainerID(containerID)
+	return true, nil
+}
+
+// startReplacement starts the cardano-tracer and node containers of c.
+func (r *runner) startReplacement(c *config.Config) (string, error) {
+	if c.CardanoTracer.Enabled {
+		if _, err := startTracer(r.ctx, r.cli, c); err != nil {
+			return "", errors.Annotate(err, "starting cardano-tracer")
+		}
+	} else if err := removeTracer(r.ctx, r.cli, c); err != nil {
+		logrus.Warn("could not remove cardano-tracer: ", err.Error())
+	}
+
+	containerID, err := startContainer(r.ctx, r.cli, c)
+	if err != nil {
+		return "", errors.Annotate(err, "starting new container")
+	}
+	return containerID, nil
+}
@@ -0,0 +1,81 @@
+package node
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/adakailabs/gocard/config"
+)
+
+// scratchName is the name of the throwaway container of a node, so one left
+// behind is replaced by the next.
+func scratchName(c *config.Config) string {
+	return c.ContainerName + "-cli"
+}
+
+// startScratch starts an idle container of docker_image to exec cardano-cli
+// in. It has no network: key generation and signing must not need one. The
+// image is only pulled when missing, so it works on an offline host.
+func startScratch(ctx context.Context, cli *client.Client, c *config.Config) (string, error) {
+	name := scratchName(c)
+	if err := removeContainerNamed(ctx, cli, name, "throwaway"); err != nil {
+		return "", err
+	}
+
+	if _, _, err := cli.ImageInspectWithRaw(ctx, c.DockerImage); client.IsErrNotFound(err) {
+		reader, err := cli.ImagePull(ctx, c.DockerImage, types.ImagePullOptions{})
+		if err != nil {
+			return "", errors.Annotatef(err, "pulling %s", c.DockerImage)
+		}
+		if _, err = io.Copy(os.Stdout, reader); err != nil {
+			return "", errors.Annotate(err, "copying to stdout")
+		}
+	} else if err != nil {
+		return "", errors.Annotatef(err, "inspecting %s", c.DockerImage)
+	}
+
+	resp, err := cli.ContainerCreate(ctx,
+		&container.Config{
+			Image:           c.DockerImage,
+			Entrypoint:      []string{"sleep", "infinity"},
+			NetworkDisabled: true,
+		},
+		&container.HostConfig{NetworkMode: "none"},
+		nil, nil, name)
+	if err != nil {
+		return "", errors.Annotate(err, "creating throwaway container")
+	}
+	if err = cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+		cli.ContainerRemove(ctx, resp.ID, types.ContainerRemoveOptions{Force: true})
+		return "", errors.Annotate(err, "starting throwaway container")
+	}
+	return resp.ID, nil
+}
+
+// removeContainerNamed stops and removes the container called name, when
+// there is one. what describes it in logs and errors.
+func removeContainerNamed(ctx context.Context, cli *client.Client, name, what string) error {
+	containers, err := cli.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("name", "^/"+name+"$")),
+	})
+	if err != nil {
+		return errors.Annotatef(err, "listing %s containers", what)
+	}
+
+	for i := range containers {
+		logrus.Infof("removing %s container with ID: %s", what, containers[i].ID)
+		if err := cli.ContainerRemove(ctx, containers[i].ID, types.ContainerRemoveOptions{Force: true}); err != nil {
+			return errors.Annotatef(err, "removing %s container", what)
+		}
+	}
+	return nil
+}
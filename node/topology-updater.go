@@ -0,0 +1,97 @@
+package node
+
+import (
+	"context"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/adakailabs/gocard/config"
+)
+
+// updaterFirstRetry is the wait before retrying a failed topology update,
+// doubled on every failure.
+const updaterFirstRetry = 10 * time.Second
+
+// updaterTicks returns a channel ticking at the topology updater interval,
+// nil when the updater is disabled so it never fires in a select. The ticker
+// is kept while the interval does not change so a reload does not push the
+// next update back. started is set when the updater was just turned on, its
+// first update is then due right away.
+func (r *runner) updaterTicks() (ticks <-chan time.Time, started bool) {
+	u := r.c.TopologyUpdater
+	if r.updaterTicker != nil {
+		if u.Enabled && u.Interval == r.updaterInterval {
+			return r.updaterTicker.C, false
+		}
+		r.updaterTicker.Stop()
+		r.updaterTicker = nil
+	}
+	if !u.Enabled {
+		r.updaterInterval = 0
+		r.updaterRetry, r.updaterBackoff = nil, 0
+		return nil, false
+	}
+	started = r.updaterInterval == 0
+	if started {
+		r.updaterRetry, r.updaterBackoff = nil, 0
+	}
+	r.updaterTicker = time.NewTicker(u.Interval)
+	r.updaterInterval = u.Interval
+	logrus.Infof("topology updater: every %s against %s", u.Interval, u.Endpoint)
+	return r.updaterTicker.C, started
+}
+
+// updateTopology registers the relay and refreshes its peers. It returns
+// true when the node was restarted to use the new topology.
+func (r *runner) updateTopology() bool {
+	changed, err := UpdateTopology(r.ctx, r.cli, r.c, r.containerID)
+	if err != nil {
+		r.retryUpdate(err)
+		return false
+	}
+	r.updaterRetry, r.updaterBackoff = nil, 0
+	if !changed || r.c.TopologyUpdater.Restart != config.RestartOnChange {
+		return false
+	}
+
+	r.cancelWait()
+	logrus.Info("topology changed, restarting container with ID: ", r.containerID)
+	if err = r.cli.ContainerRestart(r.ctx, r.containerID, nil); err != nil {
+		logrus.Error("could not restart node: ", errors.ErrorStack(err))
+	}
+	return true
+}
+
+// retryUpdate schedules another update after a failed one, backing off
+// until the wait reaches the updater interval, the ticker then takes over.
+// The node socket only shows up once the node is up, so the updates right
+// after a start fail until then.
+func (r *runner) retryUpdate(err error) {
+	if r.updaterBackoff == 0 {
+		r.updaterBackoff = updaterFirstRetry
+	} else {
+		r.updaterBackoff *= 2
+	}
+	if r.updaterBackoff >= r.c.TopologyUpdater.Interval {
+		// kept at the interval until an update succeeds
+		r.updaterRetry, r.updaterBackoff = nil, r.c.TopologyUpdater.Interval
+		logrus.Error("topology update failed: ", errors.ErrorStack(err))
+		return
+	}
+	logrus.Warnf("topology update failed, retrying in %s: %s", r.updaterBackoff, err.Error())
+	r.updaterRetry = time.After(r.updaterBackoff)
+}
+
+// UpdateTopology registers the relay running in containerID with the block
+// height of its tip and regenerates topology.json with the fetched peers.
+// It returns whether the topology changed.
+func UpdateTopology(ctx context.Context, cli *client.Client, c *config.Config, containerID string) (bool, error) {
+	tip, err := QueryTip(ctx, cli, c, containerID)
+	if err != nil {
+		return false, err
+	}
+	return c.UpdatePeers(ctx, tip.Block)
+}
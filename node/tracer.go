@@ -0,0 +1,61 @@
+package node
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/adakailabs/gocard/config"
+)
+
+// startTracer replaces the cardano-tracer container of the node, so it is
+// listening on the trace socket before the node starts.
+func startTracer(ctx context.Context, cli *client.Client, c *config.Config) (string, error) {
+	t := c.CardanoTracer
+	if err := removeTracer(ctx, cli, c); err != nil {
+		return "", err
+	}
+
+	reader, err := cli.ImagePull(ctx, t.Image, types.ImagePullOptions{})
+	if err != nil {
+		return "", errors.Annotatef(err, "pulling %s", t.Image)
+	}
+	if _, err = io.Copy(os.Stdout, reader); err != nil {
+		return "", errors.Annotate(err, "copying to stdout")
+	}
+
+	resp, err := cli.ContainerCreate(ctx, t.ContainerConfig, t.HostConfig, nil, nil, t.ContainerName)
+	if err != nil {
+		return "", errors.Annotate(err, "creating cardano-tracer container")
+	}
+	if err = cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+		return "", errors.Annotate(err, "starting cardano-tracer container")
+	}
+	logrus.Info("cardano-tracer container ID: ", resp.ID)
+	return resp.ID, nil
+}
+
+// removeTracer stops and removes the cardano-tracer container of the node,
+// when there is one.
+func removeTracer(ctx context.Context, cli *client.Client, c *config.Config) error {
+	return removeContainerNamed(ctx, cli, c.CardanoTracer.ContainerName, "cardano-tracer")
+}
+
+// stopTracer removes the cardano-tracer container when it is enabled.
+func stopTracer(c *config.Config) {
+	if !c.CardanoTracer.Enabled {
+		return
+	}
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		panic(err)
+	}
+	if err = removeTracer(context.Background(), cli, c); err != nil {
+		logrus.Error("could not stop cardano-tracer: ", errors.ErrorStack(err))
+	}
+}
@@ -0,0 +1,106 @@
+package pool
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/juju/errors"
+)
+
+// The CBOR major types found in operational certificates and counters.
+const cborUint = 0
+const cborBytes = 2
+const cborArray = 4
+
+// TextEnvelope is the JSON wrapper cardano-cli writes keys and certificates
+// in.
+type TextEnvelope struct {
+	Type        string `json:"type"`
+	Description string `json:"description"`
+	CborHex     string `json:"cborHex"`
+}
+
+// parseEnvelope reads a text envelope and decodes its CBOR.
+func parseEnvelope(data []byte) (*TextEnvelope, *cborReader, error) {
+	envelope := &TextEnvelope{}
+	if err := json.Unmarshal(data, envelope); err != nil {
+		return nil, nil, errors.Annotate(err, "parsing text envelope")
+	}
+	raw, err := hex.DecodeString(envelope.CborHex)
+	if err != nil {
+		return nil, nil, errors.Annotatef(err, "decoding cborHex of %s", envelope.Type)
+	}
+	return envelope, &cborReader{data: raw}, nil
+}
+
+// cborReader decodes the definite length CBOR items cardano-cli writes.
+type cborReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *cborReader) head(major byte) (uint64, error) {
+	if r.pos >= len(r.data) {
+		return 0, errors.New("cbor: unexpected end of data")
+	}
+	initial := r.data[r.pos]
+	r.pos++
+	if initial>>5 != major {
+		return 0, errors.Errorf("cbor: found major type %d, expected %d", initial>>5, major)
+	}
+
+	info := initial & 0x1f
+	if info < 24 {
+		return uint64(info), nil
+	}
+	size := 0
+	switch info {
+	case 24:
+		size = 1
+	case 25:
+		size = 2
+	case 26:
+		size = 4
+	case 27:
+		size = 8
+	default:
+		return 0, errors.Errorf("cbor: unsupported additional information %d", info)
+	}
+	if r.pos+size > len(r.data) {
+		return 0, errors.New("cbor: unexpected end of data")
+	}
+	buf := make([]byte, 8)
+	copy(buf[8-size:], r.data[r.pos:r.pos+size])
+	r.pos += size
+	return binary.BigEndian.Uint64(buf), nil
+}
+
+func (r *cborReader) uint() (uint64, error) {
+	return r.head(cborUint)
+}
+
+func (r *cborReader) bytes() ([]byte, error) {
+	n, err := r.head(cborBytes)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(r.data)-r.pos) < n {
+		return nil, errors.New("cbor: unexpected end of data")
+	}
+	b := r.data[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
+
+// array reads the header of an array of n items.
+func (r *cborReader) array(n uint64) error {
+	found, err := r.head(cborArray)
+	if err != nil {
+		return err
+	}
+	if found != n {
+		return errors.Errorf("cbor: found an array of %d items, expected %d", found, n)
+	}
+	return nil
+}
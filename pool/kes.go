@@ -0,0 +1,141 @@
+package pool
+
+import (
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// KESParams are the shelley genesis parameters of KES keys.
+type KESParams struct {
+	SlotsPerKESPeriod int64
+	MaxKESEvolutions  int64
+	SlotLength        time.Duration
+}
+
+// Period returns the KES period of a slot.
+func (p KESParams) Period(slot int64) int64 {
+	return slot / p.SlotsPerKESPeriod
+}
+
+// Validate makes sure the genesis defines the KES parameters.
+func (p KESParams) Validate() error {
+	if p.SlotsPerKESPeriod <= 0 || p.MaxKESEvolutions <= 0 {
+		return errors.New("the shelley genesis has no slotsPerKESPeriod or maxKESEvolutions")
+	}
+	return nil
+}
+
+// OpCert is an operational certificate.
+type OpCert struct {
+	KESVerificationKey  []byte
+	Counter             uint64
+	KESPeriod           int64
+	ColdVerificationKey []byte
+}
+
+// ParseOpCert reads an operational certificate written by cardano-cli node
+// issue-op-cert: [[kes vkey, counter, kes period, signature], cold vkey].
+func ParseOpCert(data []byte) (*OpCert, error) {
+	_, r, err := parseEnvelope(data)
+	if err != nil {
+		return nil, err
+	}
+	cert := &OpCert{}
+	if err = r.array(2); err != nil {
+		return nil, errors.Annotate(err, "operational certificate")
+	}
+	if err = r.array(4); err != nil {
+		return nil, errors.Annotate(err, "operational certificate")
+	}
+	if cert.KESVerificationKey, err = r.bytes(); err != nil {
+		return nil, errors.Annotate(err, "operational certificate KES key")
+	}
+	if cert.Counter, err = r.uint(); err != nil {
+		return nil, errors.Annotate(err, "operational certificate counter")
+	}
+	period, err := r.uint()
+	if err != nil {
+		return nil, errors.Annotate(err, "operational certificate KES period")
+	}
+	cert.KESPeriod = int64(period)
+	if _, err = r.bytes(); err != nil {
+		return nil, errors.Annotate(err, "operational certificate signature")
+	}
+	if cert.ColdVerificationKey, err = r.bytes(); err != nil {
+		return nil, errors.Annotate(err, "operational certificate cold key")
+	}
+	return cert, nil
+}
+
+// ParseCounter reads the next counter value from an operational certificate
+// issue counter file: [counter, cold vkey].
+func ParseCounter(data []byte) (uint64, error) {
+	_, r, err := parseEnvelope(data)
+	if err != nil {
+		return 0, err
+	}
+	if err = r.array(2); err != nil {
+		return 0, errors.Annotate(err, "issue counter")
+	}
+	counter, err := r.uint()
+	return counter, errors.Annotate(err, "issue counter")
+}
+
+// parseVerificationKey reads the raw key of a verification key file.
+func parseVerificationKey(data []byte) ([]byte, error) {
+	_, r, err := parseEnvelope(data)
+	if err != nil {
+		return nil, err
+	}
+	key, err := r.bytes()
+	return key, errors.Annotate(err, "verification key")
+}
+
+// KESStatus is the state of an operational certificate at a slot.
+type KESStatus struct {
+	Slot          int64
+	CurrentPeriod int64
+	// StartPeriod and EndPeriod bound the periods the certificate is valid
+	// in, the end is excluded.
+	StartPeriod int64
+	EndPeriod   int64
+	// Remaining is the number of KES periods left, the current one
+	// included.
+	Remaining  int64
+	ExpirySlot int64
+	// Expires is the estimated time of ExpirySlot.
+	Expires time.Time
+}
+
+// Status computes the KES status of cert at slot, the expiry time is
+// estimated from now.
+func Status(params KESParams, cert *OpCert, slot int64, now time.Time) (*KESStatus, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	s := &KESStatus{
+		Slot:          slot,
+		CurrentPeriod: params.Period(slot),
+		StartPeriod:   cert.KESPeriod,
+		EndPeriod:     cert.KESPeriod + params.MaxKESEvolutions,
+	}
+	s.Remaining = s.EndPeriod - s.CurrentPeriod
+	if s.Remaining < 0 {
+		s.Remaining = 0
+	}
+	s.ExpirySlot = s.EndPeriod * params.SlotsPerKESPeriod
+	s.Expires = now.Add(time.Duration(s.ExpirySlot-slot) * params.SlotLength)
+	return s, nil
+}
+
+// Expired reports whether the certificate can no longer forge blocks.
+func (s *KESStatus) Expired() bool {
+	return s.CurrentPeriod >= s.EndPeriod
+}
+
+// NotYetValid reports whether the certificate starts after the current
+// period, which the node refuses as well.
+func (s *KESStatus) NotYetValid() bool {
+	return s.CurrentPeriod < s.StartPeriod
+}
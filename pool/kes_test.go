@@ -0,0 +1,138 @@
+package pool
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readFixture(t *testing.T, name string) []byte {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func envelope(cborHex string) []byte {
+	return []byte(`{"type": "NodeOperationalCertificate", "description": "", "cborHex": "` + cborHex + `"}`)
+}
+
+func TestParseOpCert(t *testing.T) {
+	cert, err := ParseOpCert(readFixture(t, "node.cert"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.Counter != 3 || cert.KESPeriod != 412 {
+		t.Errorf("got counter %d and KES period %d, want 3 and 412", cert.Counter, cert.KESPeriod)
+	}
+	if err = certifies(cert.KESVerificationKey, readFixture(t, "kes.vkey")); err != nil {
+		t.Errorf("KES key: %s", err)
+	}
+	if err = certifies(cert.ColdVerificationKey, readFixture(t, "cold.vkey")); err != nil {
+		t.Errorf("cold key: %s", err)
+	}
+
+	invalid := []struct {
+		name string
+		data []byte
+	}{
+		{"not json", []byte("node.cert")},
+		{"bad hex", envelope("82zz")},
+		{"empty", envelope("")},
+		{"not an array", envelope("5820" + strings.Repeat("00", 32))},
+		{"short certificate", envelope("8283582000")},
+		{"truncated", envelope("828458200102")},
+		{"issue counter", readFixture(t, "cold.counter")},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if cert, err := ParseOpCert(tt.data); err == nil {
+				t.Errorf("expected an error, got %+v", cert)
+			}
+		})
+	}
+}
+
+func TestParseCounter(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    uint64
+		wantErr bool
+	}{
+		{"cardano-cli counter", readFixture(t, "cold.counter"), 4, false},
+		{"one byte counter", envelope("821818"), 24, false},
+		{"two byte counter", envelope("8219012c"), 300, false},
+		{"not an array", envelope("04"), 0, true},
+		{"not a number", envelope("824104"), 0, true},
+		{"truncated", envelope("8219"), 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCounter(tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %d", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatus(t *testing.T) {
+	params := KESParams{SlotsPerKESPeriod: 129600, MaxKESEvolutions: 62, SlotLength: time.Second}
+	cert := &OpCert{KESPeriod: 400}
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		slot          int64
+		wantCurrent   int64
+		wantRemaining int64
+		expired       bool
+		notYetValid   bool
+	}{
+		{"first slot", 400 * 129600, 400, 62, false, false},
+		{"mid period", 400*129600 + 5, 400, 62, false, false},
+		{"last period", 461*129600 + 1, 461, 1, false, false},
+		{"expired", 462 * 129600, 462, 0, true, false},
+		{"long expired", 500 * 129600, 500, 0, true, false},
+		{"not yet valid", 399 * 129600, 399, 63, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Status(params, cert, tt.slot, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.CurrentPeriod != tt.wantCurrent || s.Remaining != tt.wantRemaining {
+				t.Errorf("got period %d with %d remaining, want %d with %d",
+					s.CurrentPeriod, s.Remaining, tt.wantCurrent, tt.wantRemaining)
+			}
+			if s.StartPeriod != 400 || s.EndPeriod != 462 || s.ExpirySlot != 462*129600 {
+				t.Errorf("got periods %d to %d expiring at slot %d", s.StartPeriod, s.EndPeriod, s.ExpirySlot)
+			}
+			if want := now.Add(time.Duration(s.ExpirySlot-tt.slot) * time.Second); !s.Expires.Equal(want) {
+				t.Errorf("expires %s, want %s", s.Expires, want)
+			}
+			if s.Expired() != tt.expired || s.NotYetValid() != tt.notYetValid {
+				t.Errorf("expired %t and not yet valid %t, want %t and %t",
+					s.Expired(), s.NotYetValid(), tt.expired, tt.notYetValid)
+			}
+		})
+	}
+
+	if _, err := Status(KESParams{SlotsPerKESPeriod: 129600}, cert, 0, now); err == nil {
+		t.Error("expected an error without maxKESEvolutions")
+	}
+}
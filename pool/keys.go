@@ -0,0 +1,188 @@
+package pool
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// Runner runs commands where cardano-cli is installed, usually a container.
+// Files are exchanged through a work directory in its file system, so keys
+// never land in a directory shared with the node.
+type Runner interface {
+	// CardanoCli runs cardano-cli with args and returns its output.
+	CardanoCli(ctx context.Context, args ...string) ([]byte, error)
+	// Exec runs a command and returns its output.
+	Exec(ctx context.Context, cmd ...string) ([]byte, error)
+	// WriteFile writes data to file, in an existing directory.
+	WriteFile(ctx context.Context, file string, data []byte, mode os.FileMode) error
+}
+
+// Options tells Generate how to run cardano-cli.
+type Options struct {
+	// Network are the cardano-cli arguments selecting the network, e.g.
+	// --mainnet.
+	Network []string
+	// Era is the era command the key commands are run under, none for
+	// cardano-cli versions without era commands.
+	Era string
+}
+
+// cli runs a cardano-cli key or certificate command under the era.
+func (o Options) cli(ctx context.Context, r Runner, args ...string) ([]byte, error) {
+	if o.Era != "" {
+		args = append([]string{o.Era}, args...)
+	}
+	return r.CardanoCli(ctx, args...)
+}
+
+// keyFiles is the key set, in the layout of the key set directory. The base
+// names are unique, they are the file names in the work directory.
+var keyFiles = []File{
+	{Path: "payment/payment.skey", Role: RolePayment, Kind: KindSigningKey,
+		Description: "payment signing key, spends the pledge and fees, keep offline"},
+	{Path: "payment/payment.vkey", Role: RolePayment, Kind: KindVerificationKey,
+		Description: "payment verification key"},
+	{Path: "payment/payment.addr", Role: RolePayment, Kind: KindAddress,
+		Description: "payment address, delegated to the stake key"},
+	{Path: "stake/stake.skey", Role: RoleStake, Kind: KindSigningKey,
+		Description: "stake signing key, signs the stake address and pledge certificates, keep offline"},
+	{Path: "stake/stake.vkey", Role: RoleStake, Kind: KindVerificationKey,
+		Description: "stake verification key"},
+	{Path: "stake/stake.addr", Role: RoleStake, Kind: KindAddress,
+		Description: "stake address, the pledge and the rewards"},
+	{Path: "cold/cold.skey", Role: RoleCold, Kind: KindSigningKey,
+		Description: "pool cold signing key, issues operational certificates, keep offline"},
+	{Path: "cold/cold.vkey", Role: RoleCold, Kind: KindVerificationKey,
+		Description: "pool cold verification key, its hash is the pool id"},
+	{Path: "cold/cold.counter", Role: RoleCold, Kind: KindCounter,
+		Description: "operational certificate issue counter, keep with the cold keys"},
+	{Path: "node/vrf.skey", Role: RoleVRF, Kind: KindSigningKey,
+		Description: "VRF signing key, producer_keys.vrf_key of the block producer"},
+	{Path: "node/vrf.vkey", Role: RoleVRF, Kind: KindVerificationKey,
+		Description: "VRF verification key, used in the pool registration"},
+	{Path: "node/kes.skey", Role: RoleKES, Kind: KindSigningKey,
+		Description: "KES signing key, producer_keys.kes_key of the block producer"},
+	{Path: "node/kes.vkey", Role: RoleKES, Kind: KindVerificationKey,
+		Description: "KES verification key, signed into the operational certificate"},
+}
+
+// fileMode is the mode of a key file: signing keys and the counter are only
+// readable by their owner.
+func fileMode(f File) os.FileMode {
+	if f.Kind == KindSigningKey || f.Kind == KindCounter {
+		return 0600
+	}
+	return 0644
+}
+
+// Generate creates the payment, stake, cold, VRF and KES keys and the
+// payment and stake addresses with cardano-cli, and writes them with a
+// manifest to dir. The directory must not exist or be empty; the key set is
+// assembled next to it and moved in place once complete.
+func Generate(ctx context.Context, r Runner, dir string, opts Options) (*Manifest, error) {
+	if err := checkEmpty(dir); err != nil {
+		return nil, err
+	}
+
+	work, err := workDir(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Exec(ctx, "rm", "-rf", work)
+	in := func(name string) string { return path.Join(work, name) }
+
+	commands := [][]string{
+		{"address", "key-gen",
+			"--verification-key-file", in("payment.vkey"), "--signing-key-file", in("payment.skey")},
+		{"stake-address", "key-gen",
+			"--verification-key-file", in("stake.vkey"), "--signing-key-file", in("stake.skey")},
+		append([]string{"address", "build",
+			"--payment-verification-key-file", in("payment.vkey"),
+			"--stake-verification-key-file", in("stake.vkey"),
+			"--out-file", in("payment.addr")}, opts.Network...),
+		append([]string{"stake-address", "build",
+			"--stake-verification-key-file", in("stake.vkey"),
+			"--out-file", in("stake.addr")}, opts.Network...),
+		{"node", "key-gen",
+			"--cold-verification-key-file", in("cold.vkey"), "--cold-signing-key-file", in("cold.skey"),
+			"--operational-certificate-issue-counter-file", in("cold.counter")},
+		{"node", "key-gen-VRF",
+			"--verification-key-file", in("vrf.vkey"), "--signing-key-file", in("vrf.skey")},
+		{"node", "key-gen-KES",
+			"--verification-key-file", in("kes.vkey"), "--signing-key-file", in("kes.skey")},
+	}
+	for _, args := range commands {
+		if _, err = opts.cli(ctx, r, args...); err != nil {
+			return nil, errors.Annotatef(err, "%s %s", args[0], args[1])
+		}
+	}
+
+	m := &Manifest{Created: time.Now().UTC(), Network: opts.Network}
+	if out, err := r.CardanoCli(ctx, "version"); err == nil {
+		m.CardanoCli = strings.SplitN(strings.TrimSpace(string(out)), "\n", 2)[0]
+	}
+	out, err := opts.cli(ctx, r, "stake-pool", "id", "--cold-verification-key-file", in("cold.vkey"), "--output-format", "hex")
+	if err != nil {
+		return nil, errors.Annotate(err, "computing the pool id")
+	}
+	m.PoolID = strings.TrimSpace(string(out))
+
+	staging, err := ioutil.TempDir(filepath.Dir(dir), "."+filepath.Base(dir)+".*.tmp")
+	if err != nil {
+		return nil, errors.Annotatef(err, "creating staging dir for %s", dir)
+	}
+	defer os.RemoveAll(staging)
+
+	for _, f := range keyFiles {
+		data, err := r.Exec(ctx, "cat", in(path.Base(f.Path)))
+		if err != nil {
+			return nil, errors.Annotatef(err, "reading %s", f.Path)
+		}
+		if err = m.put(staging, f, data, fileMode(f)); err != nil {
+			return nil, err
+		}
+	}
+	if err = m.Write(staging); err != nil {
+		return nil, err
+	}
+
+	if err = os.Remove(dir); err != nil && !os.IsNotExist(err) {
+		return nil, errors.Annotatef(err, "replacing empty dir %s", dir)
+	}
+	if err = os.Rename(staging, dir); err != nil {
+		return nil, errors.Annotatef(err, "moving key set to %s", dir)
+	}
+	return m, nil
+}
+
+// checkEmpty refuses to generate over an existing key set, or into a
+// directory holding anything else.
+func checkEmpty(dir string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return errors.Annotatef(os.MkdirAll(filepath.Dir(dir), 0700), "creating dir: %s", filepath.Dir(dir))
+	}
+	if err != nil {
+		return errors.Annotatef(err, "reading %s", dir)
+	}
+	if len(entries) > 0 {
+		return errors.Errorf("%s is not empty, keys are never overwritten", dir)
+	}
+	return nil
+}
+
+// workDir creates a private directory for cardano-cli to write to.
+func workDir(ctx context.Context, r Runner) (string, error) {
+	out, err := r.Exec(ctx, "mktemp", "-d")
+	if err != nil {
+		return "", errors.Annotate(err, "creating work dir")
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,238 @@
+package pool
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/juju/errors"
+)
+
+const fakeWorkDir = "/tmp/tmp.work"
+
+// fakeRunner records the commands it is given. Files read from the work
+// dir hold their own name, failOn makes any command containing it fail.
+type fakeRunner struct {
+	calls  [][]string
+	failOn string
+}
+
+func (r *fakeRunner) run(cmd []string) error {
+	r.calls = append(r.calls, cmd)
+	for _, arg := range cmd {
+		if r.failOn != "" && arg == r.failOn {
+			return errors.Errorf("%s failed", arg)
+		}
+	}
+	return nil
+}
+
+func (r *fakeRunner) CardanoCli(ctx context.Context, args ...string) ([]byte, error) {
+	if err := r.run(append([]string{"cardano-cli"}, args...)); err != nil {
+		return nil, err
+	}
+	switch {
+	case args[0] == "version":
+		return []byte("cardano-cli 10.1.1.0 - linux-x86_64 - ghc-9.6\ngit rev 0000000\n"), nil
+	case strings.Contains(strings.Join(args, " "), "stake-pool id"):
+		return []byte("0123abcd\n"), nil
+	}
+	return nil, nil
+}
+
+func (r *fakeRunner) Exec(ctx context.Context, cmd ...string) ([]byte, error) {
+	if err := r.run(cmd); err != nil {
+		return nil, err
+	}
+	switch cmd[0] {
+	case "mktemp":
+		return []byte(fakeWorkDir + "\n"), nil
+	case "cat":
+		return []byte(path.Base(cmd[1])), nil
+	}
+	return nil, nil
+}
+
+func (r *fakeRunner) WriteFile(ctx context.Context, file string, data []byte, mode os.FileMode) error {
+	return r.run([]string{"write", file})
+}
+
+// cliCalls returns the cardano-cli commands run, without the cardano-cli.
+func (r *fakeRunner) cliCalls() [][]string {
+	calls := make([][]string, 0)
+	for _, call := range r.calls {
+		if call[0] == "cardano-cli" {
+			calls = append(calls, call[1:])
+		}
+	}
+	return calls
+}
+
+func (r *fakeRunner) removedWorkDir() bool {
+	return reflect.DeepEqual(r.calls[len(r.calls)-1], []string{"rm", "-rf", fakeWorkDir})
+}
+
+func TestGenerateCommands(t *testing.T) {
+	network := []string{"--testnet-magic", "2"}
+	in := func(name string) string { return path.Join(fakeWorkDir, name) }
+	era := func(era string, args ...string) []string {
+		if era == "" {
+			return args
+		}
+		return append([]string{era}, args...)
+	}
+
+	for _, cliEra := range []string{"latest", ""} {
+		t.Run("era "+cliEra, func(t *testing.T) {
+			r := &fakeRunner{}
+			if _, err := Generate(context.Background(), r, filepath.Join(t.TempDir(), "keys"),
+				Options{Network: network, Era: cliEra}); err != nil {
+				t.Fatal(err)
+			}
+
+			want := [][]string{
+				era(cliEra, "address", "key-gen",
+					"--verification-key-file", in("payment.vkey"), "--signing-key-file", in("payment.skey")),
+				era(cliEra, "stake-address", "key-gen",
+					"--verification-key-file", in("stake.vkey"), "--signing-key-file", in("stake.skey")),
+				era(cliEra, "address", "build",
+					"--payment-verification-key-file", in("payment.vkey"),
+					"--stake-verification-key-file", in("stake.vkey"),
+					"--out-file", in("payment.addr"), "--testnet-magic", "2"),
+				era(cliEra, "stake-address", "build",
+					"--stake-verification-key-file", in("stake.vkey"),
+					"--out-file", in("stake.addr"), "--testnet-magic", "2"),
+				era(cliEra, "node", "key-gen",
+					"--cold-verification-key-file", in("cold.vkey"), "--cold-signing-key-file", in("cold.skey"),
+					"--operational-certificate-issue-counter-file", in("cold.counter")),
+				era(cliEra, "node", "key-gen-VRF",
+					"--verification-key-file", in("vrf.vkey"), "--signing-key-file", in("vrf.skey")),
+				era(cliEra, "node", "key-gen-KES",
+					"--verification-key-file", in("kes.vkey"), "--signing-key-file", in("kes.skey")),
+				{"version"},
+				era(cliEra, "stake-pool", "id", "--cold-verification-key-file", in("cold.vkey"), "--output-format", "hex"),
+			}
+			if got := r.cliCalls(); !reflect.DeepEqual(got, want) {
+				t.Errorf("cardano-cli commands:\n%q\nwant:\n%q", got, want)
+			}
+			if !reflect.DeepEqual(r.calls[0], []string{"mktemp", "-d"}) || !r.removedWorkDir() {
+				t.Errorf("the work dir is not created first and removed last: %q", r.calls)
+			}
+		})
+	}
+}
+
+func TestGenerateKeySet(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "keys")
+	network := []string{"--mainnet"}
+	m, err := Generate(context.Background(), &fakeRunner{}, dir, Options{Network: network})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.PoolID != "0123abcd" || m.CardanoCli != "cardano-cli 10.1.1.0 - linux-x86_64 - ghc-9.6" {
+		t.Errorf("pool id %q and cardano-cli %q", m.PoolID, m.CardanoCli)
+	}
+
+	written, err := ReadManifest(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(written.Network, network) || len(written.Files) != len(keyFiles) {
+		t.Fatalf("manifest for %v lists %d files", written.Network, len(written.Files))
+	}
+	for _, f := range written.Files {
+		target := filepath.Join(dir, f.Path)
+		data, err := ioutil.ReadFile(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != path.Base(f.Path) {
+			t.Errorf("%s holds %q", f.Path, data)
+		}
+		if sum := sha256.Sum256(data); f.SHA256 != hex.EncodeToString(sum[:]) {
+			t.Errorf("%s: manifest sha256 %s does not match the file", f.Path, f.SHA256)
+		}
+
+		info, err := os.Stat(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := os.FileMode(0644)
+		if f.Kind == KindSigningKey || f.Kind == KindCounter {
+			want = 0600
+		}
+		if info.Mode().Perm() != want {
+			t.Errorf("%s has mode %s, want %s", f.Path, info.Mode().Perm(), want)
+		}
+		if f.Mode != fmt.Sprintf("%04o", want) {
+			t.Errorf("%s: manifest mode %s, want %04o", f.Path, f.Mode, want)
+		}
+	}
+
+	for _, d := range []string{dir, filepath.Join(dir, "payment"), filepath.Join(dir, "stake"),
+		filepath.Join(dir, "cold"), filepath.Join(dir, "node")} {
+		info, err := os.Stat(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0700 {
+			t.Errorf("%s has mode %s, want 0700", d, info.Mode().Perm())
+		}
+	}
+}
+
+func TestGenerateRefusesNonEmptyDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "payment.skey"), []byte("existing"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	r := &fakeRunner{}
+	if _, err := Generate(context.Background(), r, dir, Options{Network: []string{"--mainnet"}}); err == nil {
+		t.Fatal("expected a non-empty dir to be refused")
+	}
+	if len(r.calls) != 0 {
+		t.Errorf("commands run on a refused dir: %q", r.calls)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "payment.skey")); err != nil || string(data) != "existing" {
+		t.Errorf("the existing key was touched: %q, %v", data, err)
+	}
+}
+
+func TestGenerateFailureLeavesNothing(t *testing.T) {
+	tests := []struct {
+		name   string
+		failOn string
+	}{
+		{"key generation", "key-gen-KES"},
+		{"pool id", "stake-pool"},
+		{"reading the keys", "cat"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent := t.TempDir()
+			dir := filepath.Join(parent, "keys")
+			r := &fakeRunner{failOn: tt.failOn}
+			if _, err := Generate(context.Background(), r, dir, Options{Network: []string{"--mainnet"}}); err == nil {
+				t.Fatal("expected an error")
+			}
+			entries, err := ioutil.ReadDir(parent)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, entry := range entries {
+				t.Errorf("%s left behind", entry.Name())
+			}
+			if !r.removedWorkDir() {
+				t.Errorf("the work dir was not removed: %q", r.calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package pool
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+const ManifestName = "manifest.json"
+
+// Roles of the key files.
+const RolePayment = "payment"
+const RoleStake = "stake"
+const RoleCold = "cold"
+const RoleVRF = "vrf"
+const RoleKES = "kes"
+
+// Kinds of the key files.
+const KindSigningKey = "signing-key"
+const KindVerificationKey = "verification-key"
+const KindAddress = "address"
+const KindCounter = "counter"
+const KindOpCert = "operational-certificate"
+
+// Manifest describes a pool key set directory.
+type Manifest struct {
+	Created time.Time `json:"created"`
+	// Network are the cardano-cli arguments of the network the addresses
+	// were built for.
+	Network    []string `json:"network"`
+	CardanoCli string   `json:"cardanoCli,omitempty"`
+	PoolID     string   `json:"poolId,omitempty"`
+	Files      []File   `json:"files"`
+	// Pending is the KES rotation waiting for its operational certificate.
+	Pending *OpCertRequest `json:"pending,omitempty"`
+}
+
+// File is an entry of the manifest.
+type File struct {
+	// Path is relative to the key set directory.
+	Path        string `json:"path"`
+	Role        string `json:"role"`
+	Kind        string `json:"kind"`
+	Mode        string `json:"mode"`
+	SHA256      string `json:"sha256"`
+	Description string `json:"description"`
+}
+
+// Find returns the file of the given role and kind, nil when there is none.
+func (m *Manifest) Find(role, kind string) *File {
+	for i := range m.Files {
+		if m.Files[i].Role == role && m.Files[i].Kind == kind {
+			return &m.Files[i]
+		}
+	}
+	return nil
+}
+
+// ReadManifest reads the manifest of a key set directory.
+func ReadManifest(dir string) (*Manifest, error) {
+	file := filepath.Join(dir, ManifestName)
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, errors.Annotatef(err, "reading %s", file)
+	}
+	m := &Manifest{}
+	if err = json.Unmarshal(data, m); err != nil {
+		return nil, errors.Annotatef(err, "parsing %s", file)
+	}
+	return m, nil
+}
+
+// Write saves the manifest in dir.
+func (m *Manifest) Write(dir string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return errors.Annotate(err, "encoding manifest")
+	}
+	file := filepath.Join(dir, ManifestName)
+	return errors.Annotatef(writeFile(file, append(data, '\n'), 0644), "writing %s", file)
+}
+
+// writeFile writes data to the file at target through a temporary file, so
+// a key is either fully written with its final mode or not at all.
+func writeFile(target string, data []byte, mode os.FileMode) error {
+	dir, base := filepath.Split(target)
+	tmp, err := ioutil.TempFile(dir, "."+base+".*.tmp")
+	if err != nil {
+		return errors.Annotatef(err, "creating temporary file for %s", target)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err = tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return errors.Annotatef(err, "setting mode of %s", tmp.Name())
+	}
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.Annotatef(err, "writing %s", tmp.Name())
+	}
+	if err = tmp.Close(); err != nil {
+		return errors.Annotatef(err, "closing %s", tmp.Name())
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+// put writes a file of the key set and records it in the manifest,
+// replacing the entry of the same path.
+func (m *Manifest) put(dir string, f File, data []byte, mode os.FileMode) error {
+	target := filepath.Join(dir, f.Path)
+	if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+		return errors.Annotatef(err, "creating dir: %s", filepath.Dir(target))
+	}
+	if err := writeFile(target, data, mode); err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(data)
+	f.SHA256 = hex.EncodeToString(sum[:])
+	f.Mode = fmt.Sprintf("%04o", mode)
+	for i := range m.Files {
+		if m.Files[i].Path == f.Path {
+			m.Files[i] = f
+			return nil
+		}
+	}
+	m.Files = append(m.Files, f)
+	return nil
+}
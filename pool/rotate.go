@@ -0,0 +1,370 @@
+package pool
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/tidwall/gjson"
+)
+
+const pendingDir = "node/pending"
+const OpCertRequestName = "opcert-request.json"
+
+// opCertFile is the operational certificate of the key set.
+var opCertFile = File{Path: "node/node.cert", Role: RoleKES, Kind: KindOpCert,
+	Description: "operational certificate, producer_keys.operational_certificate of the block producer"}
+
+// The key set files a rotation reads or replaces, looked up in keyFiles when
+// the package is initialized.
+var (
+	kesSkeyFile     = keyFile(RoleKES, KindSigningKey)
+	kesVkeyFile     = keyFile(RoleKES, KindVerificationKey)
+	coldSkeyFile    = keyFile(RoleCold, KindSigningKey)
+	coldVkeyFile    = keyFile(RoleCold, KindVerificationKey)
+	coldCounterFile = keyFile(RoleCold, KindCounter)
+)
+
+// OpCertRequest asks the holder of the cold keys for an operational
+// certificate of new KES keys.
+type OpCertRequest struct {
+	Created time.Time `json:"created"`
+	PoolID  string    `json:"poolId,omitempty"`
+	// KESVerificationKey is relative to the key set directory.
+	KESVerificationKey string `json:"kesVerificationKey"`
+	KESPeriod          int64  `json:"kesPeriod"`
+	Counter            uint64 `json:"counter"`
+	// Commands issue the certificate with cardano-cli, from a directory
+	// holding kes.vkey and the cold keys.
+	Commands [][]string `json:"commands"`
+}
+
+// RotateOptions tells Rotate what to issue.
+type RotateOptions struct {
+	Options
+	// KESPeriod is the start period of the new certificate, the current one.
+	KESPeriod int64
+	// Counter is the counter of the new certificate, by default ChainCounter
+	// plus one. It must be at most one more than the counter of the last
+	// certificate that forged a block.
+	Counter *uint64
+	// ChainCounter is the counter of the pool's last certificate that forged
+	// a block, read from the chain with ChainCounter. Without it Counter must
+	// be given.
+	ChainCounter *uint64
+}
+
+// Rotation is the outcome of Rotate.
+type Rotation struct {
+	KESPeriod int64
+	Counter   uint64
+	// CounterReset is set when the issue counter file held another value
+	// and was set to Counter.
+	CounterReset bool
+	// Cert is the new certificate, nil when Request was written instead.
+	Cert    *OpCert
+	Request *OpCertRequest
+}
+
+// Rotate generates new KES keys in the key set at dir. When its cold
+// signing key and issue counter are present the operational certificate is
+// issued right away and replaces the current one with the keys. Otherwise
+// the keys are kept in node/pending with an opcert-request.json for the
+// holder of the cold keys, see InstallOpCert.
+func Rotate(ctx context.Context, r Runner, dir string, opts RotateOptions) (*Rotation, error) {
+	m, err := ReadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	counter, err := nextCounter(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err = checkCounter(dir, counter, opts); err != nil {
+		return nil, err
+	}
+	rot := &Rotation{KESPeriod: opts.KESPeriod, Counter: counter}
+
+	work, err := workDir(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Exec(ctx, "rm", "-rf", work)
+	in := func(name string) string { return path.Join(work, name) }
+
+	if _, err = opts.cli(ctx, r, "node", "key-gen-KES",
+		"--verification-key-file", in("kes.vkey"), "--signing-key-file", in("kes.skey")); err != nil {
+		return nil, errors.Annotate(err, "node key-gen-KES")
+	}
+	skey, err := r.Exec(ctx, "cat", in("kes.skey"))
+	if err != nil {
+		return nil, errors.Annotate(err, "reading kes.skey")
+	}
+	vkey, err := r.Exec(ctx, "cat", in("kes.vkey"))
+	if err != nil {
+		return nil, errors.Annotate(err, "reading kes.vkey")
+	}
+
+	if !exists(dir, coldSkeyFile) || !exists(dir, coldVkeyFile) || !exists(dir, coldCounterFile) {
+		rot.Request, err = writeRequest(dir, m, rot, opts.Options, skey, vkey)
+		return rot, err
+	}
+
+	for _, f := range []File{coldSkeyFile, coldVkeyFile, coldCounterFile} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, f.Path))
+		if err != nil {
+			return nil, errors.Annotatef(err, "reading %s", f.Path)
+		}
+		if err = r.WriteFile(ctx, in(path.Base(f.Path)), data, fileMode(f)); err != nil {
+			return nil, errors.Annotatef(err, "copying %s", f.Path)
+		}
+		if f.Kind == KindCounter {
+			current, err := ParseCounter(data)
+			if err != nil {
+				return nil, errors.Annotate(err, f.Path)
+			}
+			rot.CounterReset = current != counter
+		}
+	}
+	for _, args := range issueCommands(rot, in) {
+		if args[1] == "new-counter" && !rot.CounterReset {
+			continue
+		}
+		if _, err = opts.cli(ctx, r, args...); err != nil {
+			return nil, errors.Annotatef(err, "%s %s", args[0], args[1])
+		}
+	}
+
+	certData, err := r.Exec(ctx, "cat", in("node.cert"))
+	if err != nil {
+		return nil, errors.Annotate(err, "reading node.cert")
+	}
+	counterData, err := r.Exec(ctx, "cat", in("cold.counter"))
+	if err != nil {
+		return nil, errors.Annotate(err, "reading cold.counter")
+	}
+	if rot.Cert, err = ParseOpCert(certData); err != nil {
+		return nil, err
+	}
+	if rot.Cert.Counter != counter || rot.Cert.KESPeriod != opts.KESPeriod {
+		return nil, errors.Errorf("issued certificate has counter %d and KES period %d, expected %d and %d",
+			rot.Cert.Counter, rot.Cert.KESPeriod, counter, opts.KESPeriod)
+	}
+
+	for _, put := range []struct {
+		f    File
+		data []byte
+	}{{kesSkeyFile, skey}, {kesVkeyFile, vkey}, {opCertFile, certData}, {coldCounterFile, counterData}} {
+		if err = m.put(dir, put.f, put.data, fileMode(put.f)); err != nil {
+			return nil, err
+		}
+	}
+	m.Pending = nil
+	if err = os.RemoveAll(filepath.Join(dir, pendingDir)); err != nil {
+		return nil, errors.Annotate(err, "removing pending KES keys")
+	}
+	return rot, m.Write(dir)
+}
+
+// InstallOpCert installs the operational certificate issued for the
+// pending KES keys of the key set at dir, which replace the current ones.
+func InstallOpCert(dir string, certData []byte) (*OpCert, error) {
+	m, err := ReadManifest(dir)
+	if err != nil {
+		return nil, err
+	}
+	if m.Pending == nil {
+		return nil, errors.Errorf("%s has no pending KES rotation", dir)
+	}
+	cert, err := ParseOpCert(certData)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := filepath.Join(dir, pendingDir)
+	skey, err := ioutil.ReadFile(filepath.Join(pending, "kes.skey"))
+	if err != nil {
+		return nil, errors.Annotate(err, "reading pending KES key")
+	}
+	vkey, err := ioutil.ReadFile(filepath.Join(pending, "kes.vkey"))
+	if err != nil {
+		return nil, errors.Annotate(err, "reading pending KES key")
+	}
+	if err = certifies(cert.KESVerificationKey, vkey); err != nil {
+		return nil, errors.Annotate(err, "the certificate is not for the pending KES key")
+	}
+	if f := m.Find(RoleCold, KindVerificationKey); f != nil {
+		if data, err := ioutil.ReadFile(filepath.Join(dir, f.Path)); err == nil {
+			if err = certifies(cert.ColdVerificationKey, data); err != nil {
+				return nil, errors.Annotatef(err, "the certificate is not signed by %s", f.Path)
+			}
+		}
+	}
+
+	for _, put := range []struct {
+		f    File
+		data []byte
+	}{{kesSkeyFile, skey}, {kesVkeyFile, vkey}, {opCertFile, certData}} {
+		if err = m.put(dir, put.f, put.data, fileMode(put.f)); err != nil {
+			return nil, err
+		}
+	}
+	m.Pending = nil
+	if err = os.RemoveAll(pending); err != nil {
+		return nil, errors.Annotate(err, "removing pending KES keys")
+	}
+	return cert, m.Write(dir)
+}
+
+// nextCounter returns the counter of the next certificate: the given one,
+// or the one on chain plus one.
+func nextCounter(opts RotateOptions) (uint64, error) {
+	switch {
+	case opts.Counter != nil:
+		return *opts.Counter, nil
+	case opts.ChainCounter != nil:
+		return *opts.ChainCounter + 1, nil
+	}
+	return 0, errors.New("the counter on chain is unknown, the counter must be given")
+}
+
+// checkCounter refuses to move the issue counter of the key set at dir back
+// to counter, unless the counter was given.
+func checkCounter(dir string, counter uint64, opts RotateOptions) error {
+	if opts.Counter != nil || !exists(dir, coldCounterFile) {
+		return nil
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, coldCounterFile.Path))
+	if err != nil {
+		return errors.Annotatef(err, "reading %s", coldCounterFile.Path)
+	}
+	current, err := ParseCounter(data)
+	if err != nil {
+		return errors.Annotate(err, coldCounterFile.Path)
+	}
+	if current > counter {
+		return errors.Errorf("the issue counter is at %d, past %d the one on chain plus one: give the counter to set it back",
+			current, counter)
+	}
+	return nil
+}
+
+// ChainCounter returns the counter of the last certificate of poolID, a hex
+// pool id, that forged a block from the output of cardano-cli query
+// protocol-state. It is 0 for a pool that never forged one.
+func ChainCounter(protocolState []byte, poolID string) (uint64, error) {
+	if _, err := hex.DecodeString(poolID); err != nil || poolID == "" {
+		return 0, errors.Errorf("pool id %q is not hex", poolID)
+	}
+	if !gjson.ValidBytes(protocolState) {
+		return 0, errors.New("protocol state is not JSON")
+	}
+	for _, key := range []string{"oCertCounters", "csProtocol.0.oCertCounters"} {
+		counters := gjson.GetBytes(protocolState, key)
+		if !counters.IsObject() {
+			continue
+		}
+		counter := counters.Get(poolID)
+		switch {
+		case !counter.Exists():
+			return 0, nil
+		case counter.Type != gjson.Number:
+			return 0, errors.Errorf("counter of %s is not a number: %s", poolID, counter.Raw)
+		}
+		return counter.Uint(), nil
+	}
+	return 0, errors.New("protocol state has no operational certificate counters")
+}
+
+// issueCommands set the issue counter to the certificate's counter, then
+// issue the certificate, with the files named by in.
+func issueCommands(rot *Rotation, in func(string) string) [][]string {
+	return [][]string{
+		{"node", "new-counter",
+			"--cold-verification-key-file", in("cold.vkey"),
+			"--counter-value", strconv.FormatUint(rot.Counter, 10),
+			"--operational-certificate-issue-counter-file", in("cold.counter")},
+		{"node", "issue-op-cert",
+			"--kes-verification-key-file", in("kes.vkey"),
+			"--cold-signing-key-file", in("cold.skey"),
+			"--operational-certificate-issue-counter-file", in("cold.counter"),
+			"--kes-period", strconv.FormatInt(rot.KESPeriod, 10),
+			"--out-file", in("node.cert")},
+	}
+}
+
+// writeRequest keeps the new KES keys in node/pending with the request of
+// their certificate.
+func writeRequest(dir string, m *Manifest, rot *Rotation, opts Options, skey, vkey []byte) (*OpCertRequest, error) {
+	pending := filepath.Join(dir, pendingDir)
+	if err := os.MkdirAll(pending, 0700); err != nil {
+		return nil, errors.Annotatef(err, "creating dir: %s", pending)
+	}
+	if err := writeFile(filepath.Join(pending, "kes.skey"), skey, 0600); err != nil {
+		return nil, err
+	}
+	if err := writeFile(filepath.Join(pending, "kes.vkey"), vkey, 0644); err != nil {
+		return nil, err
+	}
+
+	req := &OpCertRequest{
+		Created:            time.Now().UTC(),
+		PoolID:             m.PoolID,
+		KESVerificationKey: path.Join(pendingDir, "kes.vkey"),
+		KESPeriod:          rot.KESPeriod,
+		Counter:            rot.Counter,
+	}
+	for _, args := range issueCommands(rot, func(name string) string { return name }) {
+		if opts.Era != "" {
+			args = append([]string{opts.Era}, args...)
+		}
+		req.Commands = append(req.Commands, append([]string{"cardano-cli"}, args...))
+	}
+
+	data, err := json.MarshalIndent(req, "", "  ")
+	if err != nil {
+		return nil, errors.Annotate(err, "encoding opcert request")
+	}
+	if err = writeFile(filepath.Join(pending, OpCertRequestName), append(data, '\n'), 0644); err != nil {
+		return nil, err
+	}
+	m.Pending = req
+	return req, m.Write(dir)
+}
+
+// certifies makes sure key is the key of a verification key file.
+func certifies(key, vkeyData []byte) error {
+	vkey, err := parseVerificationKey(vkeyData)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(key, vkey) {
+		return errors.New("verification keys differ")
+	}
+	return nil
+}
+
+// keyFile returns the key set file of a role and kind. It is only used to
+// initialize package variables, a missing file is a programming error.
+func keyFile(role, kind string) File {
+	for _, f := range keyFiles {
+		if f.Role == role && f.Kind == kind {
+			return f
+		}
+	}
+	err := errors.Errorf("no key file of role %s and kind %s", role, kind)
+	panic(errors.ErrorStack(err))
+}
+
+func exists(dir string, f File) bool {
+	info, err := os.Stat(filepath.Join(dir, f.Path))
+	return err == nil && info.Mode().IsRegular()
+}
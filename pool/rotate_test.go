@@ -0,0 +1,125 @@
+package pool
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// keySet writes the fixtures of files to a new key set directory and
+// returns it with its manifest.
+func keySet(t *testing.T, files map[File]string) (string, *Manifest) {
+	dir := t.TempDir()
+	m := &Manifest{}
+	for f, fixture := range files {
+		target := filepath.Join(dir, f.Path)
+		if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(target, readFixture(t, fixture), 0600); err != nil {
+			t.Fatal(err)
+		}
+		m.Files = append(m.Files, f)
+	}
+	return dir, m
+}
+
+func TestNextCounter(t *testing.T) {
+	given, onChain := uint64(7), uint64(3)
+
+	tests := []struct {
+		name    string
+		opts    RotateOptions
+		want    uint64
+		wantErr bool
+	}{
+		{"given counter", RotateOptions{Counter: &given, ChainCounter: &onChain}, 7, false},
+		{"after the one on chain", RotateOptions{ChainCounter: &onChain}, 4, false},
+		{"unknown on chain", RotateOptions{}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := nextCounter(tt.opts)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %d", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckCounter(t *testing.T) {
+	given := uint64(2)
+
+	tests := []struct {
+		name    string
+		files   map[File]string
+		counter uint64
+		opts    RotateOptions
+		wantErr bool
+	}{
+		{"issue counter at the counter", map[File]string{coldCounterFile: "cold.counter"}, 4, RotateOptions{}, false},
+		{"issue counter behind", map[File]string{coldCounterFile: "cold.counter"}, 5, RotateOptions{}, false},
+		{"issue counter past", map[File]string{coldCounterFile: "cold.counter"}, 2, RotateOptions{}, true},
+		{"set back with a given counter", map[File]string{coldCounterFile: "cold.counter"}, 2, RotateOptions{Counter: &given}, false},
+		{"no issue counter", map[File]string{kesVkeyFile: "kes.vkey"}, 0, RotateOptions{}, false},
+		{"broken issue counter", map[File]string{coldCounterFile: "kes.vkey"}, 4, RotateOptions{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, _ := keySet(t, tt.files)
+			err := checkCounter(dir, tt.counter, tt.opts)
+			if tt.wantErr != (err != nil) {
+				t.Errorf("got %v, want an error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestChainCounter(t *testing.T) {
+	const poolID = "0123abcd"
+
+	tests := []struct {
+		name    string
+		state   string
+		want    uint64
+		wantErr bool
+	}{
+		{"forged", `{"lastSlot": 10, "oCertCounters": {"0123abcd": 5, "ffff": 9}}`, 5, false},
+		{"never forged", `{"lastSlot": 10, "oCertCounters": {"ffff": 9}}`, 0, false},
+		{"older cardano-cli", `{"csProtocol": [{"oCertCounters": {"0123abcd": 2}}, {}]}`, 2, false},
+		{"no counters", `{"lastSlot": 10}`, 0, true},
+		{"not a number", `{"oCertCounters": {"0123abcd": "5"}}`, 0, true},
+		{"not JSON", `84a3`, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ChainCounter([]byte(tt.state), poolID)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %d", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ChainCounter([]byte(`{"oCertCounters": {}}`), "not.hex"); err == nil {
+		t.Error("expected a pool id that is not hex to be refused")
+	}
+}
@@ -0,0 +1,424 @@
+package setup
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/juju/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+
+	"github.com/adakailabs/gocard/config"
+)
+
+const RoleRelay = config.NodeTypeRelay
+const RoleProducer = config.NodeTypeProducer
+
+var tickerRegexp = regexp.MustCompile(`^[A-Z0-9]{3,5}$`)
+
+// Options holds every answer of the wizard. In non-interactive mode they
+// come straight from the command line flags, otherwise they are the
+// defaults offered at each prompt.
+type Options struct {
+	Output          string
+	NonInteractive  bool
+	Force           bool
+	SkipDockerCheck bool
+
+	Role           string
+	Network        string
+	PoolName       string
+	PoolTicker     string
+	ServerName     string
+	DockerImage    string
+	NodePort       int
+	PrometheusPort int
+	BaseLocal      string
+	BaseContainer  string
+
+	ByronGenesis   string
+	ShelleyGenesis string
+	AlonzoGenesis  string
+	ConwayGenesis  string
+}
+
+type wizard struct {
+	opts *Options
+	in   *bufio.Reader
+	out  io.Writer
+}
+
+// Run asks for (or, in non-interactive mode, checks) every setting and
+// writes a validated gocard.yaml to opts.Output.
+func Run(opts *Options, in io.Reader, out io.Writer) error {
+	w := &wizard{opts: opts, in: bufio.NewReader(in), out: out}
+
+	if _, err := os.Stat(opts.Output); err == nil && !opts.Force {
+		if opts.NonInteractive {
+			return errors.Errorf("%s already exists, use --force to overwrite it", opts.Output)
+		}
+		overwrite, err := w.confirm(fmt.Sprintf("%s already exists, overwrite it?", opts.Output))
+		if err != nil {
+			return err
+		}
+		if !overwrite {
+			return errors.New("setup aborted")
+		}
+	}
+
+	if err := w.checkDocker(); err != nil {
+		return err
+	}
+
+	steps := []func() error{
+		w.askRole,
+		w.askNetwork,
+		w.askPool,
+		w.askDockerImage,
+		w.askPorts,
+		w.askPaths,
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return err
+		}
+	}
+
+	return write(opts)
+}
+
+func (w *wizard) checkDocker() error {
+	if w.opts.SkipDockerCheck {
+		return nil
+	}
+
+	err := pingDocker()
+	if err == nil {
+		fmt.Fprintln(w.out, "docker: reachable")
+		return nil
+	}
+
+	if w.opts.NonInteractive {
+		return errors.Annotate(err, "docker is not reachable (use --skip-docker-check to ignore)")
+	}
+
+	fmt.Fprintln(w.out, "docker: not reachable:", err.Error())
+	ignore, err := w.confirm("continue without docker?")
+	if err != nil {
+		return err
+	}
+	if !ignore {
+		return errors.New("setup aborted")
+	}
+	return nil
+}
+
+func (w *wizard) askRole() error {
+	return w.ask("node role (relay/producer)", &w.opts.Role, func(value string) error {
+		if value != RoleRelay && value != RoleProducer {
+			return errors.Errorf("role must be %s or %s", RoleRelay, RoleProducer)
+		}
+		return nil
+	})
+}
+
+func (w *wizard) askNetwork() error {
+	err := w.ask("network (mainnet/preview/private)", &w.opts.Network, func(value string) error {
+		if value != config.NetworkMainnet && value != config.NetworkPreview && value != config.NetworkPrivate {
+			return errors.Errorf("network must be %s, %s or %s",
+				config.NetworkMainnet, config.NetworkPreview, config.NetworkPrivate)
+		}
+		return nil
+	})
+	if err != nil || w.opts.Network != config.NetworkPrivate {
+		return err
+	}
+
+	required := func(value string) error {
+		if value == "" {
+			return errors.New("a genesis file is required")
+		}
+		return fileExists(value)
+	}
+	optional := func(value string) error {
+		if value == "" {
+			return nil
+		}
+		return fileExists(value)
+	}
+
+	if err := w.ask("byron genesis file", &w.opts.ByronGenesis, required); err != nil {
+		return err
+	}
+	if err := w.ask("shelley genesis file", &w.opts.ShelleyGenesis, required); err != nil {
+		return err
+	}
+	if err := w.ask("alonzo genesis file (optional)", &w.opts.AlonzoGenesis, optional); err != nil {
+		return err
+	}
+	return w.ask("conway genesis file (optional)", &w.opts.ConwayGenesis, optional)
+}
+
+func (w *wizard) askPool() error {
+	notEmpty := func(value string) error {
+		if strings.TrimSpace(value) == "" {
+			return errors.New("value cannot be empty")
+		}
+		return nil
+	}
+
+	if err := w.ask("pool name", &w.opts.PoolName, notEmpty); err != nil {
+		return err
+	}
+	err := w.ask("pool ticker (3-5 upper case letters or digits)", &w.opts.PoolTicker, func(value string) error {
+		if !tickerRegexp.MatchString(value) {
+			return errors.Errorf("invalid ticker: %s", value)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return w.ask("server name", &w.opts.ServerName, notEmpty)
+}
+
+func (w *wizard) askDockerImage() error {
+	return w.ask("docker image", &w.opts.DockerImage, func(value string) error {
+		if strings.TrimSpace(value) == "" {
+			return errors.New("docker image cannot be empty")
+		}
+		return nil
+	})
+}
+
+func (w *wizard) askPorts() error {
+	if err := w.askPort("cardano node port", &w.opts.NodePort); err != nil {
+		return err
+	}
+	if err := w.askPort("prometheus port", &w.opts.PrometheusPort); err != nil {
+		return err
+	}
+	if w.opts.NodePort == w.opts.PrometheusPort {
+		return errors.Errorf("node and prometheus ports must differ, both are %d", w.opts.NodePort)
+	}
+	return nil
+}
+
+func (w *wizard) askPaths() error {
+	absolute := func(value string) error {
+		if !filepath.IsAbs(value) {
+			return errors.Errorf("%s is not an absolute path", value)
+		}
+		return nil
+	}
+	if err := w.ask("local cardano directory", &w.opts.BaseLocal, absolute); err != nil {
+		return err
+	}
+	return w.ask("cardano directory inside the container", &w.opts.BaseContainer, absolute)
+}
+
+func (w *wizard) askPort(question string, port *int) error {
+	value := strconv.Itoa(*port)
+	err := w.ask(question, &value, func(value string) error {
+		p, err := strconv.Atoi(value)
+		if err != nil || p < 1 || p > 65535 {
+			return errors.Errorf("invalid port: %s", value)
+		}
+		return portAvailable(p)
+	})
+	if err != nil {
+		return err
+	}
+	*port, _ = strconv.Atoi(value)
+	return nil
+}
+
+// ask prompts for a value, offering the current one as the default, until
+// it passes validate. In non-interactive mode the current value is only
+// validated.
+func (w *wizard) ask(question string, value *string, validate func(string) error) error {
+	if w.opts.NonInteractive {
+		return errors.Annotate(validate(*value), question)
+	}
+
+	for {
+		fmt.Fprintf(w.out, "%s [%s]: ", question, *value)
+		answer, err := w.in.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return errors.Annotate(err, "reading answer")
+		}
+		answer = strings.TrimSpace(answer)
+		if answer == "" {
+			answer = *value
+		}
+
+		if errV := validate(answer); errV != nil {
+			fmt.Fprintln(w.out, "  ", errV.Error())
+			if err == io.EOF {
+				return errV
+			}
+			continue
+		}
+		*value = answer
+		return nil
+	}
+}
+
+func (w *wizard) confirm(question string) (bool, error) {
+	fmt.Fprintf(w.out, "%s [y/N]: ", question)
+	answer, err := w.in.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, errors.Annotate(err, "reading answer")
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+func pingDocker() error {
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = cli.Ping(ctx)
+	return err
+}
+
+func portAvailable(port int) error {
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return errors.Errorf("port %d is not available: %s", port, err.Error())
+	}
+	return l.Close()
+}
+
+func fileExists(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return errors.Annotatef(err, "file %s", path)
+	}
+	return nil
+}
+
+const gocardTemplate = `# -------------------
+# Node Configuration
+# -------------------
+# Generated by gocard setup.
+docker_image: {{ q .DockerImage }}
+pool_name: {{ q .PoolName }}
+pool_ticker: {{ q .PoolTicker }}
+server_name: {{ q .ServerName }}
+service_is_producer: {{ .IsProducer }}
+
+expose_ports:
+  - "{{ .PrometheusPort }}/tcp"
+
+cardano_base_container: {{ q .BaseContainer }}
+cardano_base_local: {{ q .BaseLocal }}
+cardano_db: /db
+cardano_socket: /db/node.socket
+cardano_cli: /usr/local/bin/cardano-cli
+cardano_port: {{ .NodePort }}
+cardano_host_address: 0.0.0.0
+cardano_hasprometheus:
+  address: 0.0.0.0
+  port: {{ .PrometheusPort }}
+
+cardano_network: {{ q .Network }}
+{{- if eq .Network "private" }}
+cardano_private_network:
+  byron_genesis: {{ q .ByronGenesis }}
+  shelley_genesis: {{ q .ShelleyGenesis }}
+{{- if .AlonzoGenesis }}
+  alonzo_genesis: {{ q .AlonzoGenesis }}
+{{- end }}
+{{- if .ConwayGenesis }}
+  conway_genesis: {{ q .ConwayGenesis }}
+{{- end }}
+{{- end }}
+`
+
+func (o *Options) IsProducer() bool {
+	return o.Role == RoleProducer
+}
+
+// write renders the options, checks the result parses back into the
+// expected values and only then moves it in place of opts.Output.
+func write(opts *Options) error {
+	tmpl, err := template.New("gocard").Funcs(template.FuncMap{"q": strconv.Quote}).Parse(gocardTemplate)
+	if err != nil {
+		return errors.Annotate(err, "parsing gocard.yaml template")
+	}
+
+	dir := filepath.Dir(opts.Output)
+	if err = os.MkdirAll(dir, os.ModePerm); err != nil {
+		return errors.Annotatef(err, "creating dir: %s", dir)
+	}
+
+	tmp, err := ioutil.TempFile(dir, ".gocard-setup-*.yaml")
+	if err != nil {
+		return errors.Annotate(err, "creating temporary config file")
+	}
+	defer os.Remove(tmp.Name())
+
+	if err = tmpl.Execute(tmp, opts); err != nil {
+		tmp.Close()
+		return errors.Annotate(err, "rendering gocard.yaml")
+	}
+	if err = tmp.Close(); err != nil {
+		return errors.Annotate(err, "closing temporary config file")
+	}
+
+	if err = validate(tmp.Name(), opts); err != nil {
+		return errors.Annotate(err, "validating generated config")
+	}
+
+	if err = os.Rename(tmp.Name(), opts.Output); err != nil {
+		return errors.Annotatef(err, "writing %s", opts.Output)
+	}
+	logrus.Info("wrote config file: ", opts.Output)
+	return nil
+}
+
+func validate(path string, opts *Options) error {
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType("yaml")
+	if err := v.ReadInConfig(); err != nil {
+		return err
+	}
+
+	expected := map[string]string{
+		"docker_image":               opts.DockerImage,
+		"server_name":                opts.ServerName,
+		"pool_ticker":                opts.PoolTicker,
+		"cardano_network":            opts.Network,
+		"cardano_base_local":         opts.BaseLocal,
+		"cardano_base_container":     opts.BaseContainer,
+		"cardano_port":               strconv.Itoa(opts.NodePort),
+		"cardano_hasprometheus.port": strconv.Itoa(opts.PrometheusPort),
+	}
+	for key, value := range expected {
+		if got := v.GetString(key); got != value {
+			return errors.Errorf("%s is %q, expected %q", key, got, value)
+		}
+	}
+	if v.GetBool("service_is_producer") != opts.IsProducer() {
+		return errors.Errorf("service_is_producer does not match role %s", opts.Role)
+	}
+	return nil
+}
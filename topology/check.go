@@ -0,0 +1,238 @@
+package topology
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const SeverityError = "error"
+const SeverityWarning = "warning"
+
+const defaultResolveTimeout = 5 * time.Second
+
+// Issue is a problem found in a topology.
+type Issue struct {
+	Severity string
+	// Where locates the problem in the file, e.g. publicRoots[1].
+	Where   string
+	Message string
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%s: %s: %s", i.Severity, i.Where, i.Message)
+}
+
+// HostResolver looks up the addresses of a host name, *net.Resolver is one.
+type HostResolver interface {
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// CheckOptions describes the node the topology belongs to.
+type CheckOptions struct {
+	// Self are the addresses the node itself listens on, a peer pointing to
+	// one of them is a self reference.
+	Self []AccessPoint
+	// Producers are the pool's block producers, which must not be listed
+	// where the node would share them.
+	Producers []AccessPoint
+	// IsProducer is set when the topology is a block producer's.
+	IsProducer bool
+	// Resolver looks up host names, net.DefaultResolver when nil.
+	Resolver HostResolver
+	// ResolveTimeout bounds each lookup.
+	ResolveTimeout time.Duration
+}
+
+// located is an access point with its place in the file.
+type located struct {
+	where string
+	ap    AccessPoint
+	// public is set for the peers the node may share: public roots,
+	// bootstrap peers and advertised local roots.
+	public bool
+}
+
+func (f *File) accessPoints() []located {
+	points := make([]located, 0)
+	if f.Format == FormatLegacy {
+		for i, producer := range f.Legacy.Producers {
+			points = append(points, located{
+				where: fmt.Sprintf("Producers[%d]", i),
+				ap:    AccessPoint{Address: producer.Addr, Port: producer.Port},
+			})
+		}
+		return points
+	}
+
+	for i, group := range f.P2P.LocalRoots {
+		for j, ap := range group.AccessPoints {
+			points = append(points, located{
+				where:  fmt.Sprintf("localRoots[%d].accessPoints[%d]", i, j),
+				ap:     ap,
+				public: group.Advertise,
+			})
+		}
+	}
+	for i, group := range f.P2P.PublicRoots {
+		for j, ap := range group.AccessPoints {
+			points = append(points, located{
+				where:  fmt.Sprintf("publicRoots[%d].accessPoints[%d]", i, j),
+				ap:     ap,
+				public: true,
+			})
+		}
+	}
+	for i, ap := range f.P2P.BootstrapPeers {
+		points = append(points, located{where: fmt.Sprintf("bootstrapPeers[%d]", i), ap: ap, public: true})
+	}
+	return points
+}
+
+// Check validates a topology and looks for duplicate peers, host names that
+// do not resolve, self references and producers the node would share with
+// the network. Host names are resolved concurrently.
+func Check(ctx context.Context, f *File, opts CheckOptions) []Issue {
+	issues := make([]Issue, 0)
+	if err := f.Validate(); err != nil {
+		issues = append(issues, Issue{Severity: SeverityError, Where: "topology", Message: err.Error()})
+	}
+
+	points := f.accessPoints()
+	seen := make(map[string]string)
+	for _, point := range points {
+		key := apKey(point.ap)
+		if first, ok := seen[key]; ok {
+			issues = append(issues, Issue{Severity: SeverityWarning, Where: point.where,
+				Message: fmt.Sprintf("%s is already listed at %s", key, first)})
+			continue
+		}
+		seen[key] = point.where
+	}
+
+	addresses := resolveAll(ctx, points, opts)
+	for _, point := range points {
+		resolved := addresses[strings.ToLower(point.ap.Address)]
+		if resolved.err != "" {
+			issues = append(issues, Issue{Severity: SeverityWarning, Where: point.where,
+				Message: fmt.Sprintf("%s does not resolve: %s", point.ap.Address, resolved.err)})
+		}
+		if matchesAny(point.ap, resolved, opts.Self, addresses) {
+			issues = append(issues, Issue{Severity: SeverityError, Where: point.where,
+				Message: fmt.Sprintf("%s points to this node itself", apKey(point.ap))})
+		}
+		if point.public && matchesAny(point.ap, resolved, opts.Producers, addresses) {
+			issues = append(issues, Issue{Severity: SeverityError, Where: point.where,
+				Message: fmt.Sprintf("%s is a block producer of the pool, it must not be shared", apKey(point.ap))})
+		}
+	}
+
+	if opts.IsProducer && f.Format == FormatP2P {
+		if len(f.P2P.PublicRoots) > 0 || len(f.P2P.BootstrapPeers) > 0 {
+			issues = append(issues, Issue{Severity: SeverityWarning, Where: "publicRoots",
+				Message: "a block producer should only connect to the pool's relays"})
+		}
+		if f.P2P.UseLedgerAfterSlot == nil || *f.P2P.UseLedgerAfterSlot >= 0 {
+			issues = append(issues, Issue{Severity: SeverityWarning, Where: "useLedgerAfterSlot",
+				Message: fmt.Sprintf("a block producer should not use ledger peers, set it to %d", NeverUseLedger)})
+		}
+	}
+	return issues
+}
+
+// HasErrors reports whether any of the issues is an error.
+func HasErrors(issues []Issue) bool {
+	for _, issue := range issues {
+		if issue.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+func apKey(ap AccessPoint) string {
+	return net.JoinHostPort(strings.ToLower(ap.Address), fmt.Sprint(ap.Port))
+}
+
+// resolution is the outcome of looking up a host name.
+type resolution struct {
+	ips []string
+	err string
+}
+
+// resolveAll looks up every host name of points and of the self and
+// producer addresses, once each. IP addresses resolve to themselves.
+func resolveAll(ctx context.Context, points []located, opts CheckOptions) map[string]resolution {
+	var resolver HostResolver = net.DefaultResolver
+	if opts.Resolver != nil {
+		resolver = opts.Resolver
+	}
+	timeout := opts.ResolveTimeout
+	if timeout == 0 {
+		timeout = defaultResolveTimeout
+	}
+
+	hosts := make(map[string]bool)
+	for _, point := range points {
+		hosts[strings.ToLower(point.ap.Address)] = true
+	}
+	for _, ap := range append(append([]AccessPoint{}, opts.Self...), opts.Producers...) {
+		hosts[strings.ToLower(ap.Address)] = true
+	}
+
+	results := make(map[string]resolution, len(hosts))
+	mu := &sync.Mutex{}
+	wg := &sync.WaitGroup{}
+	for host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			mu.Lock()
+			results[host] = resolution{ips: []string{ip.String()}}
+			mu.Unlock()
+			continue
+		}
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			lookupCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			ips, err := resolver.LookupHost(lookupCtx, host)
+
+			res := resolution{}
+			for _, ip := range ips {
+				res.ips = append(res.ips, net.ParseIP(ip).String())
+			}
+			if err != nil {
+				res.err = err.Error()
+			}
+			mu.Lock()
+			results[host] = res
+			mu.Unlock()
+		}(host)
+	}
+	wg.Wait()
+	return results
+}
+
+// matchesAny reports whether ap is one of targets, by name or by any
+// resolved address, on the same port.
+func matchesAny(ap AccessPoint, resolved resolution, targets []AccessPoint, results map[string]resolution) bool {
+	for _, target := range targets {
+		if target.Port != ap.Port {
+			continue
+		}
+		if strings.EqualFold(target.Address, ap.Address) {
+			return true
+		}
+		for _, ip := range results[strings.ToLower(target.Address)].ips {
+			for _, peerIP := range resolved.ips {
+				if ip == peerIP {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
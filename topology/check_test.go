@@ -0,0 +1,176 @@
+package topology
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// fakeResolver resolves the host names it holds, any other name is not
+// found.
+type fakeResolver map[string][]string
+
+func (r fakeResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if ips, ok := r[host]; ok {
+		return ips, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func legacyFile(peers ...AccessPoint) *File {
+	legacy := &Legacy{Producers: make([]LegacyProducer, 0, len(peers))}
+	for _, ap := range peers {
+		legacy.Producers = append(legacy.Producers, LegacyProducer{Addr: ap.Address, Port: ap.Port, Valency: 1})
+	}
+	return &File{Format: FormatLegacy, Legacy: legacy}
+}
+
+func p2pFile(p2p *P2P) *File {
+	if p2p.LocalRoots == nil {
+		p2p.LocalRoots = []LocalRoots{}
+	}
+	if p2p.PublicRoots == nil {
+		p2p.PublicRoots = []PublicRoots{}
+	}
+	return &File{Format: FormatP2P, P2P: p2p}
+}
+
+func TestCheck(t *testing.T) {
+	resolver := fakeResolver{
+		"relay1.example.com":   {"10.0.0.1"},
+		"relay2.example.com":   {"10.0.0.2"},
+		"producer.example.com": {"10.0.0.9"},
+		"public.example.com":   {"192.0.2.10"},
+	}
+	relay1 := AccessPoint{Address: "relay1.example.com", Port: 3001}
+	relay2 := AccessPoint{Address: "relay2.example.com", Port: 3001}
+	producer := AccessPoint{Address: "producer.example.com", Port: 6000}
+	public := AccessPoint{Address: "public.example.com", Port: 3001}
+	never := int64(NeverUseLedger)
+
+	tests := []struct {
+		name       string
+		file       *File
+		opts       CheckOptions
+		want       []string
+		wantErrors bool
+	}{
+		{
+			name: "clean",
+			file: legacyFile(relay2, public),
+			opts: CheckOptions{Self: []AccessPoint{relay1}, Producers: []AccessPoint{producer}},
+			want: []string{},
+		},
+		{
+			name: "duplicate",
+			file: legacyFile(relay2, public, AccessPoint{Address: "RELAY2.example.com", Port: 3001}),
+			want: []string{"warning Producers[2]"},
+		},
+		{
+			name: "same host on another port is no duplicate",
+			file: legacyFile(relay2, AccessPoint{Address: "relay2.example.com", Port: 3002}),
+			want: []string{},
+		},
+		{
+			name:       "self by name",
+			file:       legacyFile(relay1, public),
+			opts:       CheckOptions{Self: []AccessPoint{relay1}},
+			want:       []string{"error Producers[0]"},
+			wantErrors: true,
+		},
+		{
+			name:       "self by resolved address",
+			file:       legacyFile(public, relay1),
+			opts:       CheckOptions{Self: []AccessPoint{{Address: "10.0.0.1", Port: 3001}}},
+			want:       []string{"error Producers[1]"},
+			wantErrors: true,
+		},
+		{
+			name:       "self by the resolved address of its own name",
+			file:       legacyFile(AccessPoint{Address: "10.0.0.1", Port: 3001}),
+			opts:       CheckOptions{Self: []AccessPoint{relay1}},
+			want:       []string{"error Producers[0]"},
+			wantErrors: true,
+		},
+		{
+			name: "self on another port",
+			file: legacyFile(AccessPoint{Address: "relay1.example.com", Port: 3002}),
+			opts: CheckOptions{Self: []AccessPoint{relay1}},
+			want: []string{},
+		},
+		{
+			name: "producer in a private local root",
+			file: p2pFile(&P2P{LocalRoots: []LocalRoots{{AccessPoints: []AccessPoint{producer, relay2}, Trustable: true, Valency: 2}}}),
+			opts: CheckOptions{Producers: []AccessPoint{producer}},
+			want: []string{},
+		},
+		{
+			name: "producer in public roots",
+			file: p2pFile(&P2P{
+				LocalRoots:     []LocalRoots{{AccessPoints: []AccessPoint{producer}, Advertise: true, Valency: 1}},
+				PublicRoots:    []PublicRoots{{AccessPoints: []AccessPoint{public}}, {AccessPoints: []AccessPoint{{Address: "10.0.0.9", Port: 6000}}}},
+				BootstrapPeers: []AccessPoint{producer},
+			}),
+			opts: CheckOptions{Producers: []AccessPoint{producer}},
+			want: []string{
+				"error localRoots[0].accessPoints[0]",
+				"error publicRoots[1].accessPoints[0]",
+				"error bootstrapPeers[0]",
+				"warning bootstrapPeers[0]",
+			},
+			wantErrors: true,
+		},
+		{
+			name: "unresolvable host is a warning",
+			file: legacyFile(relay2, AccessPoint{Address: "gone.example.com", Port: 3001}),
+			opts: CheckOptions{Self: []AccessPoint{relay1}, Producers: []AccessPoint{producer}},
+			want: []string{"warning Producers[1]"},
+		},
+		{
+			name: "producer sharing peers",
+			file: p2pFile(&P2P{
+				LocalRoots:  []LocalRoots{{AccessPoints: []AccessPoint{relay1, relay2}, Trustable: true, Valency: 2}},
+				PublicRoots: []PublicRoots{{AccessPoints: []AccessPoint{public}}},
+			}),
+			opts: CheckOptions{IsProducer: true},
+			want: []string{"warning publicRoots", "warning useLedgerAfterSlot"},
+		},
+		{
+			name: "producer with the pool's relays only",
+			file: p2pFile(&P2P{
+				LocalRoots:         []LocalRoots{{AccessPoints: []AccessPoint{relay1, relay2}, Trustable: true, Valency: 2}},
+				UseLedgerAfterSlot: &never,
+			}),
+			opts: CheckOptions{IsProducer: true},
+			want: []string{},
+		},
+		{
+			name:       "invalid topology",
+			file:       legacyFile(AccessPoint{Address: "relay2.example.com", Port: 0}),
+			want:       []string{"error topology"},
+			wantErrors: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Resolver = resolver
+			issues := Check(context.Background(), tt.file, tt.opts)
+
+			got := make([]string, 0, len(issues))
+			for _, issue := range issues {
+				got = append(got, issue.Severity+" "+issue.Where)
+			}
+			sort.Strings(got)
+			want := append([]string{}, tt.want...)
+			sort.Strings(want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %v, want %v", issues, want)
+			}
+			if HasErrors(issues) != tt.wantErrors {
+				t.Errorf("HasErrors is %t, want %t", HasErrors(issues), tt.wantErrors)
+			}
+		})
+	}
+}
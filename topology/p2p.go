@@ -0,0 +1,265 @@
+package topology
+
+import (
+	"encoding/json"
+
+	"github.com/juju/errors"
+)
+
+const FormatLegacy = "legacy"
+const FormatP2P = "p2p"
+
+// NeverUseLedger is the useLedgerAfterSlot value that disables ledger
+// peers, used for block producers.
+const NeverUseLedger = -1
+
+// AccessPoint is an address of a P2P root.
+type AccessPoint struct {
+	Address string `json:"address"`
+	Port    int    `json:"port"`
+}
+
+// LocalRoots is a group of peers the node always tries to stay connected
+// to, valency of them at a time.
+type LocalRoots struct {
+	AccessPoints []AccessPoint `json:"accessPoints"`
+	Advertise    bool          `json:"advertise"`
+	Trustable    bool          `json:"trustable"`
+	Valency      int           `json:"valency,omitempty"`
+	HotValency   int           `json:"hotValency,omitempty"`
+	WarmValency  int           `json:"warmValency,omitempty"`
+}
+
+// PublicRoots is a group of peers used until ledger peers are available.
+type PublicRoots struct {
+	AccessPoints []AccessPoint `json:"accessPoints"`
+	Advertise    bool          `json:"advertise"`
+}
+
+// P2P is the topology format of P2P nodes.
+type P2P struct {
+	LocalRoots     []LocalRoots  `json:"localRoots"`
+	PublicRoots    []PublicRoots `json:"publicRoots"`
+	BootstrapPeers []AccessPoint `json:"bootstrapPeers,omitempty"`
+	// UseLedgerAfterSlot enables ledger peers from that slot, never when
+	// negative.
+	UseLedgerAfterSlot *int64 `json:"useLedgerAfterSlot,omitempty"`
+	PeerSnapshotFile   string `json:"peerSnapshotFile,omitempty"`
+}
+
+// NewP2P builds a P2P topology for a node of the layout, connecting the
+// same nodes as Layout.Peers. The pool's own nodes form a trustable local
+// roots group and the public peers are public roots. A producer never uses
+// ledger, public or bootstrap peers.
+func NewP2P(layout *Layout, isProducer bool, self string) *P2P {
+	p2p := &P2P{
+		LocalRoots:  make([]LocalRoots, 0, 1),
+		PublicRoots: make([]PublicRoots, 0, len(layout.PublicPeers)),
+	}
+
+	local := LocalRoots{Trustable: true}
+	if !isProducer {
+		local.AccessPoints = append(local.AccessPoints, accessPoint(layout.Producer))
+	}
+	for _, relay := range layout.Relays {
+		if !isProducer && self != "" && relay.Name == self {
+			continue
+		}
+		local.AccessPoints = append(local.AccessPoints, accessPoint(relay))
+	}
+	if len(local.AccessPoints) > 0 {
+		local.Valency = len(local.AccessPoints)
+		p2p.LocalRoots = append(p2p.LocalRoots, local)
+	}
+
+	if isProducer {
+		never := int64(NeverUseLedger)
+		p2p.UseLedgerAfterSlot = &never
+		return p2p
+	}
+
+	if layout.UseLedgerAfterSlot != nil {
+		slot := *layout.UseLedgerAfterSlot
+		p2p.UseLedgerAfterSlot = &slot
+	}
+	for _, peer := range layout.PublicPeers {
+		p2p.PublicRoots = append(p2p.PublicRoots, PublicRoots{
+			AccessPoints: []AccessPoint{accessPoint(peer)},
+			Advertise:    peer.Advertise,
+		})
+	}
+	for _, peer := range layout.BootstrapPeers {
+		p2p.BootstrapPeers = append(p2p.BootstrapPeers, accessPoint(peer))
+	}
+	return p2p
+}
+
+// AddPublicRoots adds the peers that are not in the topology yet as public
+// roots.
+func (p *P2P) AddPublicRoots(peers []Peer) {
+	known := make(map[string]bool)
+	for _, peer := range (&File{Format: FormatP2P, P2P: p}).Peers() {
+		known[peer.Key()] = true
+	}
+	for _, peer := range peers {
+		if known[peer.Key()] {
+			continue
+		}
+		known[peer.Key()] = true
+		p.PublicRoots = append(p.PublicRoots, PublicRoots{
+			AccessPoints: []AccessPoint{accessPoint(peer)},
+			Advertise:    peer.Advertise,
+		})
+	}
+}
+
+func accessPoint(peer Peer) AccessPoint {
+	return AccessPoint{Address: peer.Address, Port: peer.Port}
+}
+
+// Validate checks every group has valid access points and valencies.
+func (p *P2P) Validate() error {
+	for i, group := range p.LocalRoots {
+		if len(group.AccessPoints) == 0 {
+			return errors.Errorf("localRoots[%d]: no access points", i)
+		}
+		if err := validateAccessPoints(group.AccessPoints); err != nil {
+			return errors.Annotatef(err, "localRoots[%d]", i)
+		}
+		valency := group.Valency
+		if group.HotValency != 0 {
+			valency = group.HotValency
+		}
+		if valency <= 0 {
+			return errors.Errorf("localRoots[%d]: valency must be positive, found %d", i, valency)
+		}
+		if group.WarmValency != 0 && group.WarmValency < valency {
+			return errors.Errorf("localRoots[%d]: warmValency %d is lower than hotValency %d",
+				i, group.WarmValency, valency)
+		}
+	}
+	for i, group := range p.PublicRoots {
+		if len(group.AccessPoints) == 0 {
+			return errors.Errorf("publicRoots[%d]: no access points", i)
+		}
+		if err := validateAccessPoints(group.AccessPoints); err != nil {
+			return errors.Annotatef(err, "publicRoots[%d]", i)
+		}
+	}
+	if err := validateAccessPoints(p.BootstrapPeers); err != nil {
+		return errors.Annotate(err, "bootstrapPeers")
+	}
+	if p.UseLedgerAfterSlot != nil && *p.UseLedgerAfterSlot < NeverUseLedger {
+		return errors.Errorf("useLedgerAfterSlot must be %d or a slot, found %d", NeverUseLedger, *p.UseLedgerAfterSlot)
+	}
+	return nil
+}
+
+func validateAccessPoints(accessPoints []AccessPoint) error {
+	for i, ap := range accessPoints {
+		if ap.Address == "" {
+			return errors.Errorf("accessPoints[%d]: address is required", i)
+		}
+		if ap.Port <= 0 || ap.Port > 65535 {
+			return errors.Errorf("accessPoints[%d]: invalid port %d", i, ap.Port)
+		}
+	}
+	return nil
+}
+
+// Validate checks every producer has an address, a port and a valency.
+func (l *Legacy) Validate() error {
+	for i, producer := range l.Producers {
+		if producer.Addr == "" {
+			return errors.Errorf("Producers[%d]: addr is required", i)
+		}
+		if producer.Port <= 0 || producer.Port > 65535 {
+			return errors.Errorf("Producers[%d]: invalid port %d", i, producer.Port)
+		}
+		if producer.Valency <= 0 {
+			return errors.Errorf("Producers[%d]: valency must be positive, found %d", i, producer.Valency)
+		}
+	}
+	return nil
+}
+
+// File is a parsed topology file, in either format.
+type File struct {
+	Format string
+	Legacy *Legacy
+	P2P    *P2P
+}
+
+// Parse reads a topology file, telling the format from its keys.
+func Parse(data []byte) (*File, error) {
+	keys := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, errors.Annotate(err, "parsing topology")
+	}
+
+	if _, ok := keys["Producers"]; ok {
+		legacy := &Legacy{}
+		if err := json.Unmarshal(data, legacy); err != nil {
+			return nil, errors.Annotate(err, "parsing legacy topology")
+		}
+		return &File{Format: FormatLegacy, Legacy: legacy}, nil
+	}
+
+	p2p := &P2P{}
+	if err := json.Unmarshal(data, p2p); err != nil {
+		return nil, errors.Annotate(err, "parsing p2p topology")
+	}
+	return &File{Format: FormatP2P, P2P: p2p}, nil
+}
+
+// Validate validates the topology of the file's format.
+func (f *File) Validate() error {
+	if f.Format == FormatLegacy {
+		return f.Legacy.Validate()
+	}
+	return f.P2P.Validate()
+}
+
+// ConvertOptions tells ConvertLegacy how to place the legacy producers.
+type ConvertOptions struct {
+	// Public lists the addresses that become public roots, every other
+	// producer becomes a local root.
+	Public []string
+	// Trustable marks the local roots as trustable.
+	Trustable bool
+	// UseLedgerAfterSlot is written as is when set.
+	UseLedgerAfterSlot *int64
+}
+
+// ConvertLegacy turns a legacy topology into a P2P one. Each local producer
+// becomes its own local roots group keeping its valency, so a DNS name
+// keeps as many connections as before.
+func ConvertLegacy(legacy *Legacy, opts ConvertOptions) *P2P {
+	public := make(map[string]bool, len(opts.Public))
+	for _, address := range opts.Public {
+		public[address] = true
+	}
+
+	p2p := &P2P{
+		LocalRoots:         make([]LocalRoots, 0, len(legacy.Producers)),
+		PublicRoots:        make([]PublicRoots, 0, len(opts.Public)),
+		UseLedgerAfterSlot: opts.UseLedgerAfterSlot,
+	}
+	for _, producer := range legacy.Producers {
+		accessPoints := []AccessPoint{{Address: producer.Addr, Port: producer.Port}}
+		if public[producer.Addr] {
+			p2p.PublicRoots = append(p2p.PublicRoots, PublicRoots{AccessPoints: accessPoints})
+			continue
+		}
+		valency := producer.Valency
+		if valency <= 0 {
+			valency = DefaultValency
+		}
+		p2p.LocalRoots = append(p2p.LocalRoots, LocalRoots{
+			AccessPoints: accessPoints,
+			Trustable:    opts.Trustable,
+			Valency:      valency,
+		})
+	}
+	return p2p
+}
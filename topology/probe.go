@@ -0,0 +1,171 @@
+package topology
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+const UnknownRegion = "unknown"
+
+// ProbeOptions tells Probe how to measure the peers.
+type ProbeOptions struct {
+	// Timeout bounds each connection attempt.
+	Timeout time.Duration
+	// Attempts is the number of connections made to each peer, the fastest
+	// one is kept.
+	Attempts int
+	// Concurrency is the number of peers probed at a time.
+	Concurrency int
+}
+
+// ProbeResult is the outcome of probing a peer.
+type ProbeResult struct {
+	Peer      Peer
+	Reachable bool
+	// Latency is the fastest TCP connect time of the attempts.
+	Latency time.Duration
+	// Attempts is the number of connections tried, Failures counts the ones
+	// that did not connect.
+	Attempts int
+	Failures int
+	Err      error
+}
+
+// Probe measures the TCP connect latency of every peer and returns the
+// results ranked: reachable peers by latency, then the unreachable ones.
+func Probe(ctx context.Context, peers []Peer, opts ProbeOptions) []ProbeResult {
+	if opts.Attempts <= 0 {
+		opts.Attempts = 1
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+
+	results := make([]ProbeResult, len(peers))
+	slots := make(chan struct{}, opts.Concurrency)
+	wg := &sync.WaitGroup{}
+	for i := range peers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			results[i] = probePeer(ctx, peers[i], opts)
+		}(i)
+	}
+	wg.Wait()
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Reachable != results[j].Reachable {
+			return results[i].Reachable
+		}
+		return results[i].Latency < results[j].Latency
+	})
+	return results
+}
+
+func probePeer(ctx context.Context, peer Peer, opts ProbeOptions) ProbeResult {
+	result := ProbeResult{Peer: peer, Attempts: opts.Attempts}
+	address := net.JoinHostPort(peer.Address, strconv.Itoa(peer.Port))
+	dialer := &net.Dialer{Timeout: opts.Timeout}
+
+	for attempt := 0; attempt < opts.Attempts; attempt++ {
+		start := time.Now()
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			result.Failures++
+			result.Err = err
+			continue
+		}
+		latency := time.Since(start)
+		conn.Close()
+
+		if !result.Reachable || latency < result.Latency {
+			result.Latency = latency
+		}
+		result.Reachable = true
+	}
+	if result.Reachable {
+		result.Err = nil
+	}
+	return result
+}
+
+// BestPerRegion returns the n fastest reachable peers of each region, in
+// rank order. Peers without a region are grouped as UnknownRegion.
+func BestPerRegion(results []ProbeResult, n int) []Peer {
+	counts := make(map[string]int)
+	best := make([]Peer, 0)
+	for _, result := range results {
+		if !result.Reachable {
+			continue
+		}
+		region := Region(result.Peer)
+		if counts[region] >= n {
+			continue
+		}
+		counts[region]++
+		best = append(best, result.Peer)
+	}
+	return best
+}
+
+// Region returns the region of a peer, UnknownRegion when it has none.
+func Region(peer Peer) string {
+	if peer.Region == "" {
+		return UnknownRegion
+	}
+	return peer.Region
+}
+
+// ParsePeer reads a peer given as address:port, optionally followed by
+// @region, e.g. relay.example.com:3001@EU or [2001:db8::1]:3001.
+func ParsePeer(value string) (Peer, error) {
+	peer := Peer{Valency: DefaultValency}
+	if i := strings.LastIndex(value, "@"); i >= 0 {
+		peer.Region = value[i+1:]
+		value = value[:i]
+	}
+
+	host, port, err := net.SplitHostPort(value)
+	if err != nil {
+		return peer, errors.Annotatef(err, "peer %s", value)
+	}
+	if peer.Port, err = strconv.Atoi(port); err != nil || peer.Port <= 0 || peer.Port > 65535 {
+		return peer, errors.Errorf("peer %s: invalid port %s", value, port)
+	}
+	peer.Address = host
+	return peer, nil
+}
+
+// Peers returns every peer a topology file points to.
+func (f *File) Peers() []Peer {
+	peers := make([]Peer, 0)
+	if f.Format == FormatLegacy {
+		for _, producer := range f.Legacy.Producers {
+			peers = append(peers, Peer{Address: producer.Addr, Port: producer.Port, Valency: producer.Valency})
+		}
+		return MergePeers(peers)
+	}
+
+	add := func(accessPoints []AccessPoint) {
+		for _, ap := range accessPoints {
+			peers = append(peers, Peer{Address: ap.Address, Port: ap.Port, Valency: DefaultValency})
+		}
+	}
+	for _, group := range f.P2P.LocalRoots {
+		add(group.AccessPoints)
+	}
+	for _, group := range f.P2P.PublicRoots {
+		add(group.AccessPoints)
+	}
+	add(f.P2P.BootstrapPeers)
+	return MergePeers(peers)
+}
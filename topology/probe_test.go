@@ -0,0 +1,141 @@
+package topology
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParsePeer(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Peer
+		wantErr bool
+	}{
+		{"relay.example.com:3001", Peer{Address: "relay.example.com", Port: 3001, Valency: DefaultValency}, false},
+		{"relay.example.com:3001@EU", Peer{Address: "relay.example.com", Port: 3001, Valency: DefaultValency, Region: "EU"}, false},
+		{"[2001:db8::1]:3001", Peer{Address: "2001:db8::1", Port: 3001, Valency: DefaultValency}, false},
+		{"[2001:db8::1]:3001@NA", Peer{Address: "2001:db8::1", Port: 3001, Valency: DefaultValency, Region: "NA"}, false},
+		{"relay.example.com", Peer{}, true},
+		{"relay.example.com:0", Peer{}, true},
+		{"relay.example.com:65536", Peer{}, true},
+		{"relay.example.com:port", Peer{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParsePeer(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBestPerRegion(t *testing.T) {
+	peer := func(address, region string) Peer {
+		return Peer{Address: address, Port: 3001, Region: region}
+	}
+	results := []ProbeResult{
+		{Peer: peer("eu1", "EU"), Reachable: true},
+		{Peer: peer("na1", "NA"), Reachable: true},
+		{Peer: peer("eu2", "EU"), Reachable: true},
+		{Peer: peer("any1", ""), Reachable: true},
+		{Peer: peer("eu3", "EU"), Reachable: true},
+		{Peer: peer("na2", "NA"), Reachable: false},
+		{Peer: peer("any2", ""), Reachable: true},
+	}
+
+	tests := []struct {
+		n    int
+		want []string
+	}{
+		{0, []string{}},
+		{1, []string{"eu1", "na1", "any1"}},
+		{2, []string{"eu1", "na1", "eu2", "any1", "any2"}},
+		{5, []string{"eu1", "na1", "eu2", "any1", "eu3", "any2"}},
+	}
+	for _, tt := range tests {
+		got := make([]string, 0)
+		for _, p := range BestPerRegion(results, tt.n) {
+			got = append(got, p.Address)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("n=%d: got %v, want %v", tt.n, got, tt.want)
+		}
+	}
+}
+
+// closedPort returns a local port nothing listens on.
+func closedPort(t *testing.T) int {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	return port
+}
+
+func TestProbeRanking(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	open := Peer{Name: "open", Address: "127.0.0.1", Port: l.Addr().(*net.TCPAddr).Port}
+	closed := Peer{Name: "closed", Address: "127.0.0.1", Port: closedPort(t)}
+
+	tests := []struct {
+		name         string
+		opts         ProbeOptions
+		wantAttempts int
+	}{
+		{"attempts default to one", ProbeOptions{Timeout: time.Second}, 1},
+		{"attempts are kept", ProbeOptions{Timeout: time.Second, Attempts: 3, Concurrency: 2}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := Probe(context.Background(), []Peer{closed, open}, tt.opts)
+			if len(results) != 2 {
+				t.Fatalf("got %d results", len(results))
+			}
+
+			first, last := results[0], results[1]
+			if first.Peer.Name != "open" || !first.Reachable || first.Failures != 0 || first.Err != nil {
+				t.Errorf("first is %+v, want the open peer", first)
+			}
+			if last.Peer.Name != "closed" || last.Reachable || last.Err == nil {
+				t.Errorf("last is %+v, want the closed peer", last)
+			}
+			for _, result := range results {
+				if result.Attempts != tt.wantAttempts {
+					t.Errorf("%s: %d attempts, want %d", result.Peer.Name, result.Attempts, tt.wantAttempts)
+				}
+			}
+			if last.Failures != tt.wantAttempts {
+				t.Errorf("closed peer failed %d/%d", last.Failures, last.Attempts)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package topology
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+const DefaultValency = 1
+
+// Peer is a node the topology points to.
+type Peer struct {
+	Name    string `mapstructure:"name" json:"name,omitempty"`
+	Address string `mapstructure:"address" json:"address"`
+	Port    int    `mapstructure:"port" json:"port"`
+	// Valency is the number of connections kept to the peer, for a DNS name
+	// usually the number of addresses it resolves to.
+	Valency int `mapstructure:"valency" json:"valency"`
+	// Advertise lets the node share the peer with other peers, it only
+	// applies to the public roots of the P2P topology.
+	Advertise bool `mapstructure:"advertise" json:"advertise,omitempty"`
+	// Region is where the peer is located, as reported by the topology
+	// updater.
+	Region string `mapstructure:"region" json:"region,omitempty"`
+}
+
+// Key identifies a peer by address and port.
+func (p Peer) Key() string {
+	return fmt.Sprintf("%s:%d", strings.ToLower(p.Address), p.Port)
+}
+
+// MergePeers concatenates peer lists, keeping the first of the peers with
+// the same address and port.
+func MergePeers(lists ...[]Peer) []Peer {
+	seen := make(map[string]bool)
+	merged := make([]Peer, 0)
+	for _, peers := range lists {
+		for _, peer := range peers {
+			if seen[peer.Key()] {
+				continue
+			}
+			seen[peer.Key()] = true
+			merged = append(merged, peer)
+		}
+	}
+	return merged
+}
+
+func (p Peer) String() string {
+	if p.Name != "" {
+		return fmt.Sprintf("%s (%s:%d)", p.Name, p.Address, p.Port)
+	}
+	return fmt.Sprintf("%s:%d", p.Address, p.Port)
+}
+
+// Layout is the pool_layout section of gocard.yaml: the block producer, the
+// pool's own relays and the public peers the relays connect to.
+type Layout struct {
+	// Format is the format of the generated topology, legacy by default.
+	Format      string `mapstructure:"format"`
+	Producer    Peer   `mapstructure:"producer"`
+	Relays      []Peer `mapstructure:"relays"`
+	PublicPeers []Peer `mapstructure:"public_peers"`
+	// Valency is used for the peers that do not set their own.
+	Valency int `mapstructure:"valency"`
+	// BootstrapPeers and UseLedgerAfterSlot only apply to the P2P topology
+	// of relays.
+	BootstrapPeers     []Peer `mapstructure:"bootstrap_peers"`
+	UseLedgerAfterSlot *int64 `mapstructure:"use_ledger_after_slot"`
+}
+
+// Validate checks the format and that every peer of the layout has an
+// address and a port.
+func (l *Layout) Validate() error {
+	switch l.Format {
+	case "":
+		l.Format = FormatLegacy
+	case FormatLegacy, FormatP2P:
+	default:
+		return errors.Errorf("pool_layout.format must be %s or %s, found: %s", FormatLegacy, FormatP2P, l.Format)
+	}
+	if l.Producer.Address == "" {
+		return errors.New("pool_layout.producer: address is required")
+	}
+	if len(l.Relays) == 0 {
+		return errors.New("pool_layout.relays: at least one relay is required")
+	}
+
+	check := func(section string, peers []Peer) error {
+		for i, peer := range peers {
+			if peer.Address == "" {
+				return errors.Errorf("pool_layout.%s[%d]: address is required", section, i)
+			}
+			if peer.Port <= 0 || peer.Port > 65535 {
+				return errors.Errorf("pool_layout.%s[%d]: invalid port %d", section, i, peer.Port)
+			}
+			if peer.Valency < 0 {
+				return errors.Errorf("pool_layout.%s[%d]: invalid valency %d", section, i, peer.Valency)
+			}
+		}
+		return nil
+	}
+	if err := check("producer", []Peer{l.Producer}); err != nil {
+		return err
+	}
+	if err := check("relays", l.Relays); err != nil {
+		return err
+	}
+	if err := check("public_peers", l.PublicPeers); err != nil {
+		return err
+	}
+	return check("bootstrap_peers", l.BootstrapPeers)
+}
+
+// Peers returns the peers of a node of the layout. The producer only talks
+// to the pool's relays, a relay talks to the producer, the other relays and
+// the public peers. self is the name of the relay the topology is for, it
+// is left out of its own peers.
+func (l *Layout) Peers(isProducer bool, self string) []Peer {
+	peers := make([]Peer, 0, len(l.Relays)+len(l.PublicPeers)+1)
+	add := func(peer Peer) {
+		if peer.Valency == 0 {
+			peer.Valency = l.valency()
+		}
+		peers = append(peers, peer)
+	}
+
+	if isProducer {
+		for _, relay := range l.Relays {
+			add(relay)
+		}
+		return peers
+	}
+
+	add(l.Producer)
+	for _, relay := range l.Relays {
+		if self != "" && relay.Name == self {
+			continue
+		}
+		add(relay)
+	}
+	for _, peer := range l.PublicPeers {
+		add(peer)
+	}
+	return peers
+}
+
+// HasRelay reports whether name is one of the layout's relays.
+func (l *Layout) HasRelay(name string) bool {
+	for _, relay := range l.Relays {
+		if relay.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *Layout) valency() int {
+	if l.Valency > 0 {
+		return l.Valency
+	}
+	return DefaultValency
+}
+
+// LegacyProducer is an entry of the legacy topology.
+type LegacyProducer struct {
+	Addr    string `json:"addr"`
+	Port    int    `json:"port"`
+	Valency int    `json:"valency"`
+}
+
+// Legacy is the topology format of non-P2P nodes.
+type Legacy struct {
+	Producers []LegacyProducer `json:"Producers"`
+}
+
+// NewLegacy builds a legacy topology pointing to peers.
+func NewLegacy(peers []Peer) *Legacy {
+	legacy := &Legacy{Producers: make([]LegacyProducer, 0, len(peers))}
+	for _, peer := range peers {
+		legacy.Producers = append(legacy.Producers, LegacyProducer{
+			Addr:    peer.Address,
+			Port:    peer.Port,
+			Valency: peer.Valency,
+		})
+	}
+	return legacy
+}
+
+// Encode renders a topology the way the published files are formatted.
+func Encode(topology interface{}) ([]byte, error) {
+	data, err := json.MarshalIndent(topology, "", "  ")
+	if err != nil {
+		return nil, errors.Annotate(err, "encoding topology")
+	}
+	return append(data, '\n'), nil
+}
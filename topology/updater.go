@@ -0,0 +1,127 @@
+package topology
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+const DefaultUpdaterEndpoint = "https://api.clio.one/htopology/v1"
+
+// Updater is a client of a topology updater service: relays register
+// themselves every hour to be listed, and fetch the list of the other
+// registered relays.
+type Updater struct {
+	Endpoint string
+	Client   *http.Client
+}
+
+// Registration is what a relay reports when registering.
+type Registration struct {
+	Port     int
+	BlockNo  int64
+	Valency  int
+	Magic    int64
+	Hostname string
+}
+
+// updaterResponse is the body of every updater reply. The result code is
+// 2xx on success, the message tells why otherwise.
+type updaterResponse struct {
+	ResultCode string            `json:"resultcode"`
+	Message    string            `json:"msg"`
+	ClientIP   string            `json:"clientIp"`
+	Producers  []updaterProducer `json:"Producers"`
+}
+
+type updaterProducer struct {
+	Addr      string `json:"addr"`
+	Port      int    `json:"port"`
+	Valency   int    `json:"valency"`
+	Continent string `json:"continent"`
+}
+
+// Register announces the relay, it returns the message of the service.
+func (u *Updater) Register(ctx context.Context, reg Registration) (string, error) {
+	query := url.Values{}
+	query.Set("port", strconv.Itoa(reg.Port))
+	query.Set("blockNo", strconv.FormatInt(reg.BlockNo, 10))
+	query.Set("valency", strconv.Itoa(reg.Valency))
+	query.Set("magic", strconv.FormatInt(reg.Magic, 10))
+	if reg.Hostname != "" {
+		query.Set("hostname", reg.Hostname)
+	}
+
+	resp, err := u.get(ctx, "/", query)
+	if err != nil {
+		return "", errors.Annotate(err, "registering relay")
+	}
+	return fmt.Sprintf("%s (%s)", resp.Message, resp.ClientIP), nil
+}
+
+// Fetch returns up to max registered relays of the network, only of the
+// given IP version when it is not 0.
+func (u *Updater) Fetch(ctx context.Context, max int, magic int64, ipVersion int) ([]Peer, error) {
+	query := url.Values{}
+	query.Set("max", strconv.Itoa(max))
+	query.Set("magic", strconv.FormatInt(magic, 10))
+	if ipVersion != 0 {
+		query.Set("ipv", strconv.Itoa(ipVersion))
+	}
+
+	resp, err := u.get(ctx, "/fetch/", query)
+	if err != nil {
+		return nil, errors.Annotate(err, "fetching peers")
+	}
+
+	peers := make([]Peer, 0, len(resp.Producers))
+	for _, producer := range resp.Producers {
+		valency := producer.Valency
+		if valency <= 0 {
+			valency = DefaultValency
+		}
+		peers = append(peers, Peer{
+			Address: producer.Addr,
+			Port:    producer.Port,
+			Valency: valency,
+			Region:  producer.Continent,
+		})
+	}
+	return peers, nil
+}
+
+func (u *Updater) get(ctx context.Context, path string, query url.Values) (*updaterResponse, error) {
+	endpoint := strings.TrimSuffix(u.Endpoint, "/") + path + "?" + query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, errors.Annotate(err, "building request")
+	}
+
+	client := u.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	httpResp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("%s: unexpected status %s", u.Endpoint, httpResp.Status)
+	}
+	resp := &updaterResponse{}
+	if err = json.NewDecoder(httpResp.Body).Decode(resp); err != nil {
+		return nil, errors.Annotatef(err, "%s: decoding response", u.Endpoint)
+	}
+	if !strings.HasPrefix(resp.ResultCode, "2") {
+		return nil, errors.Errorf("%s: result code %s: %s", u.Endpoint, resp.ResultCode, resp.Message)
+	}
+	return resp, nil
+}